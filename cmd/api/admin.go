@@ -0,0 +1,450 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+var (
+	ErrUserBanned         = errors.New("user is banned")
+	ErrUserRoleNotBelow   = errors.New("only users with a role below your own can be managed")
+	ErrAssignRoleAboveOwn = errors.New("roles above your own can't be assigned")
+)
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" validate:"required,max=255"`
+} //	@name	UpdateUserRoleRequest
+
+type BanUserRequest struct {
+	Reason    string     `json:"reason" validate:"required,max=500"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty"`
+} //	@name	BanUserRequest
+
+// unlockUserHandler godoc
+//
+//	@Summary		Unlocks a user
+//	@Description	Unlocks an account that was locked after too many failed login attempts, and forgets the failed attempts. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User unlocked"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/unlock [put]
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := app.GetIDFromURL(ctx)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Users.Unlock(ctx, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.LoginAttempts.ClearFailures(ctx, user.Email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.audit(r, auditUserUnlocked, auditTargetUser, user.ID, map[string]any{"locked_until": user.LockedUntil}, map[string]any{"locked_until": nil})
+
+	app.logger.Infow("user unlocked", "userID", user.ID, "adminID", app.getAuthedUser(ctx).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getAdminUsersHandler godoc
+//
+//	@Summary		Lists users
+//	@Description	Lists all users, including inactive and banned users, newest first. Search matches the username, email and display name. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			admin
+//	@Produce		json
+//	@Param			search	query		string	false	"Search"
+//	@Param			role	query		string	false	"Role name"
+//	@Param			status	query		string	false	"One of active, inactive, banned and locked"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	PageResponse{data=[]User}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users [get]
+func (app *application) getAdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pageable := store.Pageable{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "DESC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filter := new(store.UserFilter).Parse(r)
+	if err := Validate.StructCtx(ctx, filter); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := app.store.Users.Search(ctx, filter, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, users.Items, newPageMeta(pageable, users)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getAdminUserHandler godoc
+//
+//	@Summary		Fetches a user
+//	@Description	Fetches a user, including inactive and banned users
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	User
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id} [get]
+func (app *application) getAdminUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getAdminTargetUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateUserRoleHandler godoc
+//
+//	@Summary		Changes the role of a user
+//	@Description	Changes the role of a user with a role below your own. The new role can't be above your own role. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"User ID"
+//	@Param			payload	body		UpdateUserRoleRequest	true	"New role"
+//	@Success		200		{object}	User
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/role [put]
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload UpdateUserRoleRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAdminTargetUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	role, err := app.store.Roles.GetByName(ctx, payload.Role)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrRoleNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	admin := app.getAuthedUser(ctx)
+	if role.Level > admin.Role.Level {
+		app.forbiddenResponse(w, r, ErrAssignRoleAboveOwn)
+		return
+	}
+
+	if err := app.store.Users.SetRole(ctx, user.ID, role.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.audit(r, auditUserRoleChanged, auditTargetUser, user.ID, map[string]any{"role": user.Role.Name}, map[string]any{"role": role.Name})
+	app.logger.Infow("user role changed", "userID", user.ID, "from", user.Role.Name, "to", role.Name, "adminID", admin.ID)
+
+	app.respondWithAdminUser(w, r, user.ID)
+}
+
+// banUserHandler godoc
+//
+//	@Summary		Bans a user
+//	@Description	Bans a user with a role below your own, until expires_at or for good, and signs them out everywhere. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"User ID"
+//	@Param			payload	body		BanUserRequest	true	"Ban"
+//	@Success		200		{object}	User
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/ban [put]
+func (app *application) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload BanUserRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		app.badRequestResponse(w, r, errors.New("expires_at must be in the future"))
+		return
+	}
+
+	user, ok := app.getAdminTargetUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Users.Ban(ctx, user.ID, payload.Reason, payload.ExpiresAt); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.revokeUserSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.audit(r, auditUserBanned, auditTargetUser, user.ID,
+		map[string]any{"ban_reason": user.BanReason, "banned_until": user.BannedUntil},
+		map[string]any{"ban_reason": payload.Reason, "banned_until": payload.ExpiresAt},
+	)
+	app.logger.Infow("user banned", "userID", user.ID, "until", payload.ExpiresAt, "adminID", app.getAuthedUser(ctx).ID)
+
+	app.respondWithAdminUser(w, r, user.ID)
+}
+
+// unbanUserHandler godoc
+//
+//	@Summary		Unbans a user
+//	@Description	Lifts the ban of a user with a role below your own. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	User
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/ban [delete]
+func (app *application) unbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := app.getAdminTargetUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Users.Unban(ctx, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.audit(r, auditUserUnbanned, auditTargetUser, user.ID,
+		map[string]any{"ban_reason": user.BanReason, "banned_until": user.BannedUntil},
+		map[string]any{"ban_reason": nil, "banned_until": nil},
+	)
+	app.logger.Infow("user unbanned", "userID", user.ID, "adminID", app.getAuthedUser(ctx).ID)
+
+	app.respondWithAdminUser(w, r, user.ID)
+}
+
+// activateUserByAdminHandler godoc
+//
+//	@Summary		Activates a user
+//	@Description	Activates a user that has not accepted their invitation. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	User
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/activate [put]
+func (app *application) activateUserByAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := app.getAdminTargetUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Users.ForceActivate(ctx, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.audit(r, auditUserActivated, auditTargetUser, user.ID, map[string]any{"is_active": user.IsActive}, map[string]any{"is_active": true})
+	app.logger.Infow("user activated by admin", "userID", user.ID, "adminID", app.getAuthedUser(ctx).ID)
+
+	app.respondWithAdminUser(w, r, user.ID)
+}
+
+// logoutUserHandler godoc
+//
+//	@Summary		Signs a user out everywhere
+//	@Description	Revokes all sessions of a user with a role below your own, including their access tokens. It needs a session, as API keys are rejected
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User signed out"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{id}/logout [post]
+func (app *application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := app.getAdminTargetUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := app.revokeUserSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditUserSignedOut, auditTargetUser, user.ID, nil, nil)
+	app.logger.Infow("user signed out by admin", "userID", user.ID, "adminID", app.getAuthedUser(ctx).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getAdminTargetUser loads the user of the URL, including inactive users.
+// With requireLowerRole, only users with a role below the role of the admin
+// can be managed.
+func (app *application) getAdminTargetUser(w http.ResponseWriter, r *http.Request, requireLowerRole bool) (*store.User, bool) {
+	ctx := r.Context()
+
+	userID, err := app.GetIDFromURL(ctx)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	user, err := app.store.Users.GetForAdmin(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if requireLowerRole && user.Role.Level >= app.getAuthedUser(ctx).Role.Level {
+		app.forbiddenResponse(w, r, ErrUserRoleNotBelow)
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) respondWithAdminUser(w http.ResponseWriter, r *http.Request, userID int64) {
+	user, err := app.store.Users.GetForAdmin(r.Context(), userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/addvanced/gophersocial/internal/db"
 	"github.com/addvanced/gophersocial/internal/env"
 	"github.com/addvanced/gophersocial/internal/mailer"
+	"github.com/addvanced/gophersocial/internal/ratelimiter"
 	"github.com/addvanced/gophersocial/internal/store"
 	"github.com/addvanced/gophersocial/internal/store/cache"
 	"github.com/go-chi/chi/v5"
@@ -33,7 +35,10 @@ type application struct {
 	cacheStorage  cache.Storage
 	mailer        mailer.Client
 	authenticator auth.Authenticator
+	rateLimiter   ratelimiter.Limiter
 	logger        *zap.SugaredLogger
+
+	identityProviders map[string]auth.IdentityProvider
 }
 
 type config struct {
@@ -42,10 +47,20 @@ type config struct {
 	apiURL      string
 	frontendURL string
 
+	// trustedProxies are the addresses of the proxies allowed to set the
+	// client IP through the X-Forwarded-For and X-Real-IP headers.
+	trustedProxies []netip.Prefix
+
 	mail  mailConfig
 	auth  authConfig
 	db    db.PostgresConfig
 	redis cache.RedisConfig
+	jobs  jobsConfig
+	posts postsConfig
+
+	moderation moderationConfig
+
+	rateLimit rateLimitConfig
 }
 
 type mailConfig struct {
@@ -54,7 +69,8 @@ type mailConfig struct {
 
 	resend resendConfig
 
-	inviteExpDuration time.Duration
+	inviteExpDuration        time.Duration
+	passwordResetExpDuration time.Duration
 }
 
 type resendConfig struct {
@@ -62,9 +78,64 @@ type resendConfig struct {
 	fromEmail string
 }
 
+// rateLimitConfig holds the limits per route group. Authenticated routes are
+// limited per user, and public routes per IP.
+type rateLimitConfig struct {
+	enabled bool
+
+	api      ratelimiter.Limit
+	auth     ratelimiter.Limit
+	token    ratelimiter.Limit
+	posts    ratelimiter.Limit
+	comments ratelimiter.Limit
+}
+
+type postsConfig struct {
+	reactionTypes []string
+}
+
+// moderationConfig holds the moderation settings. Content is hidden once it
+// has reportHideThreshold open reports, and never when it is 0.
+type moderationConfig struct {
+	reportHideThreshold int
+}
+
+type jobsConfig struct {
+	cleanupInterval      time.Duration
+	unactivatedUserGrace time.Duration
+	auditRetention       time.Duration
+}
+
 type authConfig struct {
 	basic basicAuthConfig
 	jwt   jwtAuthConfig
+	login loginConfig
+	totp  totpConfig
+	oidc  oidcConfig
+}
+
+// oidcConfig configures sign in with external OpenID Connect providers.
+type oidcConfig struct {
+	providers             []auth.OIDCConfig
+	authRequestExpiration time.Duration
+}
+
+type totpConfig struct {
+	issuer               string
+	challengeExpiration  time.Duration
+	maxChallengeAttempts int
+}
+
+// loginConfig configures the brute-force protection of the token endpoint.
+// Failed attempts are counted within failureWindow, and every failure doubles
+// the delay of the next attempt, starting at baseDelay.
+type loginConfig struct {
+	maxAccountFailures int
+	maxIPFailures      int
+	failureWindow      time.Duration
+	lockoutDuration    time.Duration
+	baseDelay          time.Duration
+	maxDelay           time.Duration
 }
 
 type basicAuthConfig struct {
@@ -73,23 +144,30 @@ type basicAuthConfig struct {
 }
 
 type jwtAuthConfig struct {
-	secret     string
-	issuer     string
-	expiration time.Duration
+	secret            string
+	issuer            string
+	expiration        time.Duration
+	refreshExpiration time.Duration
+
+	// Asymmetric signing keys. The shared secret is used when no signing key
+	// file is configured.
+	signingKeyFile       string
+	signingKeyID         string
+	verificationKeyFiles []string
 }
 
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.RealIPMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -101,6 +179,8 @@ func (app *application) mount() http.Handler {
 		_, _ = w.Write([]byte("nothing here..."))
 	})
 
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 		r.With(app.BasicAuthMiddleware()).
 			Get("/health", app.healthCheckHandler)
@@ -110,40 +190,204 @@ func (app *application) mount() http.Handler {
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware())
-			r.Post("/", app.createPostHandler)
+			r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
+
+			r.With(app.RequireScopeMiddleware(scopePostsWrite), app.RateLimitMiddleware("posts", app.config.rateLimit.posts)).
+				Post("/", app.createPostHandler)
 
 			r.Route("/{id}", func(r chi.Router) {
 				r.Use(app.addPostToCtxMiddleware)
 
 				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequireScopeMiddleware(scopePostsWrite))
+
+					r.Patch("/", app.checkPostOwnership(permPostsUpdateAny, app.updatePostHandler))
+					r.Delete("/", app.checkPostOwnership(permPostsDeleteAny, app.deletePostHandler))
+
+					r.Put("/reactions/{type}", app.reactToPostHandler)
+					r.Delete("/reactions/{type}", app.deletePostReactionHandler)
+
+					r.Post("/report", app.reportPostHandler)
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.getPostCommentsHandler)
+					r.With(app.RequireScopeMiddleware(scopeCommentsWrite), app.RateLimitMiddleware("comments", app.config.rateLimit.comments)).
+						Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.addCommentToCtxMiddleware)
+
+						r.Get("/replies", app.getCommentRepliesHandler)
+
+						r.With(app.RequireScopeMiddleware(scopeCommentsWrite)).
+							Patch("/", app.checkCommentOwnership(permCommentsUpdateAny, app.updateCommentHandler))
+						r.With(app.RequireScopeMiddleware(scopeCommentsWrite)).
+							Delete("/", app.checkCommentOwnership(permCommentsDeleteAny, app.deleteCommentHandler))
+						r.With(app.RequireScopeMiddleware(scopeCommentsWrite)).
+							Post("/report", app.reportCommentHandler)
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler)
+			r.With(app.RateLimitMiddleware("auth", app.config.rateLimit.auth)).
+				Put("/activate/{token}", app.activateUserHandler)
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware())
+				r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
+
+				r.Get("/", app.getMeHandler)
+				r.With(app.RequireScopeMiddleware(scopeUsersWrite)).
+					Patch("/", app.updateMeHandler)
+
+				r.Get("/follow-requests", app.getFollowRequestsHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequireScopeMiddleware(scopeUsersWrite))
+
+					r.Put("/follow-requests/{id}", app.approveFollowRequestHandler)
+					r.Delete("/follow-requests/{id}", app.rejectFollowRequestHandler)
+				})
+
+				// Credentials and account management need a session
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequireScopeMiddleware(scopeAccount))
+
+					r.Delete("/", app.deleteMeHandler)
+
+					r.Put("/password", app.changePasswordHandler)
+					r.Put("/email", app.changeEmailHandler)
+
+					r.Get("/identities", app.getMyIdentitiesHandler)
+					r.Delete("/identities/{provider}", app.deleteMyIdentityHandler)
+
+					r.Get("/api-keys", app.getMyAPIKeysHandler)
+					r.Post("/api-keys", app.createAPIKeyHandler)
+					r.Delete("/api-keys/{keyID}", app.deleteAPIKeyHandler)
+
+					r.Route("/2fa", func(r chi.Router) {
+						r.Post("/totp", app.enrollTOTPHandler)
+						r.Post("/totp/verify", app.verifyTOTPHandler)
+						r.Delete("/totp", app.disableTOTPHandler)
+						r.Post("/recovery-codes", app.regenerateRecoveryCodesHandler)
+					})
+				})
+			})
 
 			r.Route("/{id}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware())
+				r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
 
 				r.Get("/", app.getUserHandler)
-
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Get("/followers", app.getUserFollowersHandler)
+				r.Get("/following", app.getUserFollowingHandler)
+
+				r.With(app.RequireScopeMiddleware(scopeUsersWrite)).
+					Put("/follow", app.followUserHandler)
+				r.With(app.RequireScopeMiddleware(scopeUsersWrite)).
+					Put("/unfollow", app.unfollowUserHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequireScopeMiddleware(scopeUsersWrite))
+
+					r.Put("/block", app.blockUserHandler)
+					r.Delete("/block", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Delete("/mute", app.unmuteUserHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware())
+				r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 		})
 
+		// Privileged routes need a session, so no API key can reach them
+		// whatever its scopes
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware())
+			r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
+			r.Use(app.RequireScopeMiddleware(scopeAccount))
+
+			r.Route("/users", func(r chi.Router) {
+				r.With(app.RequirePermissionMiddleware(permUsersManage)).
+					Get("/", app.getAdminUsersHandler)
+
+				r.Route("/{id}", func(r chi.Router) {
+					r.With(app.RequirePermissionMiddleware(permUsersUnlock)).
+						Put("/unlock", app.unlockUserHandler)
+
+					r.With(app.RequirePermissionMiddleware(permUsersBan)).
+						Put("/ban", app.banUserHandler)
+					r.With(app.RequirePermissionMiddleware(permUsersBan)).
+						Delete("/ban", app.unbanUserHandler)
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.RequirePermissionMiddleware(permUsersManage))
+
+						r.Get("/", app.getAdminUserHandler)
+						r.Put("/role", app.updateUserRoleHandler)
+						r.Put("/activate", app.activateUserByAdminHandler)
+						r.Post("/logout", app.logoutUserHandler)
+					})
+				})
+			})
+
+			r.Route("/roles", func(r chi.Router) {
+				r.Use(app.RequirePermissionMiddleware(permRolesManage))
+
+				r.Get("/", app.getRolesHandler)
+				r.Put("/{role}/permissions/{permission}", app.grantPermissionHandler)
+				r.Delete("/{role}/permissions/{permission}", app.revokePermissionHandler)
+			})
+
+			r.With(app.RequirePermissionMiddleware(permRolesManage)).
+				Get("/permissions", app.getPermissionsHandler)
+
+			r.With(app.RequirePermissionMiddleware(permAuditRead)).
+				Get("/audit-events", app.getAuditEventsHandler)
+		})
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware())
+			r.Use(app.RateLimitMiddleware("api", app.config.rateLimit.api))
+			r.Use(app.RequireScopeMiddleware(scopeAccount))
+			r.Use(app.RequirePermissionMiddleware(permReportsManage))
+
+			r.Get("/reports", app.getReportsHandler)
+			r.Get("/reports/{reportID}", app.getReportHandler)
+			r.Put("/reports/{reportID}", app.resolveReportHandler)
+		})
+
 		// Public routes
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.createTokenHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.RateLimitMiddleware("auth", app.config.rateLimit.auth))
+
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/activation/resend", app.resendActivationHandler)
+				r.With(app.RateLimitMiddleware("token", app.config.rateLimit.token)).
+					Post("/token", app.createTokenHandler)
+				r.With(app.RateLimitMiddleware("token", app.config.rateLimit.token)).
+					Post("/token/2fa", app.createTwoFactorTokenHandler)
+				r.Post("/refresh", app.refreshTokenHandler)
+
+				r.Get("/oidc/{provider}", app.oidcAuthorizeHandler)
+				r.With(app.RateLimitMiddleware("token", app.config.rateLimit.token)).
+					Post("/oidc/{provider}/token", app.oidcTokenHandler)
+
+				r.Post("/password/forgot", app.forgotPasswordHandler)
+				r.Post("/password/reset", app.resetPasswordHandler)
+			})
 
+			r.With(app.AuthTokenMiddleware(), app.RateLimitMiddleware("api", app.config.rateLimit.api), app.RequireScopeMiddleware(scopeAccount)).
+				Post("/logout", app.logoutHandler)
 		})
 	})
 
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+const (
+	apiKeyCtxKey ctxKey = "apiKey"
+
+	// apiKeyPrefix marks bearer tokens that are API keys rather than JWTs.
+	apiKeyPrefix = "gsk_"
+
+	maxAPIKeysPerUser = 25
+
+	// apiKeyTouchInterval is how often the last use of a key is recorded.
+	apiKeyTouchInterval = time.Minute
+)
+
+// Scopes of API keys. Sessions have all scopes, while an API key only has the
+// write scopes it was created with. Every key can read.
+const (
+	scopePostsWrite    = "posts:write"
+	scopeCommentsWrite = "comments:write"
+	scopeUsersWrite    = "users:write"
+
+	// scopeAccount covers credentials and account management, and can't be
+	// granted to API keys.
+	scopeAccount = "account"
+)
+
+var (
+	ErrTooManyAPIKeys    = fmt.Errorf("a user can have at most %d API keys", maxAPIKeysPerUser)
+	ErrInvalidAPIKey     = errors.New("API key is invalid or expired")
+	ErrInsufficientScope = errors.New("API key does not have the required scope")
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"omitempty,unique,dive,oneof=posts:write comments:write users:write"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty"`
+} //	@name	CreateAPIKeyRequest
+
+// CreatedAPIKeyResponse is a new API key, with the plain key that is only
+// shown once.
+type CreatedAPIKeyResponse struct {
+	store.APIKey
+	Key string `json:"key"`
+} //	@name	CreatedAPIKeyResponse
+
+// getMyAPIKeysHandler godoc
+//
+//	@Summary		Fetches the API keys
+//	@Description	Fetches the personal API keys of the authenticated user, with when they were last used
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	[]APIKey
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys [get]
+func (app *application) getMyAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	keys, err := app.store.APIKeys.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, keys); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createAPIKeyHandler godoc
+//
+//	@Summary		Creates an API key
+//	@Description	Creates a personal API key, to use as a bearer token instead of a JWT. Every key can read, and writes need the matching scope. The key is only returned once
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAPIKeyRequest	true	"API key"
+//	@Success		201		{object}	CreatedAPIKeyResponse
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys [post]
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	var payload CreateAPIKeyRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		app.badRequestResponse(w, r, errors.New("expires_at must be in the future"))
+		return
+	}
+
+	count, err := app.store.APIKeys.CountByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	} else if count >= maxAPIKeysPerUser {
+		app.conflictResponse(w, r, ErrTooManyAPIKeys)
+		return
+	}
+
+	plainKey, hashedKey, err := generateAPIKey()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	key := &store.APIKey{
+		UserID:   user.ID,
+		Name:     payload.Name,
+		Prefix:   plainKey[:len(apiKeyPrefix)+8],
+		Scopes:   payload.Scopes,
+		ExpireAt: payload.ExpiresAt,
+	}
+
+	if err := app.store.APIKeys.Create(ctx, key, hashedKey); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditAPIKeyCreated, auditTargetAPIKey, key.ID, nil, key)
+	app.logger.Infow("API key created", "userID", user.ID, "apiKeyID", key.ID, "scopes", key.Scopes)
+
+	if err := app.jsonResponse(w, http.StatusCreated, CreatedAPIKeyResponse{APIKey: *key, Key: plainKey}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteAPIKeyHandler godoc
+//
+//	@Summary		Revokes an API key
+//	@Description	Revokes a personal API key of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Param			keyID	path		int		true	"API key ID"
+//	@Success		204		{string}	string	"API key revoked"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys/{keyID} [delete]
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	keyID, err := app.GetInt64URLParam(ctx, "keyID")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.APIKeys.Delete(ctx, keyID, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditAPIKeyRevoked, auditTargetAPIKey, keyID, nil, nil)
+	app.logger.Infow("API key revoked", "userID", user.ID, "apiKeyID", keyID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateAPIKey looks up the user of an API key, and records its use.
+func (app *application) authenticateAPIKey(ctx context.Context, plainKey string) (*store.APIKey, *store.User, error) {
+	key, err := app.store.APIKeys.GetByKey(ctx, plainKey)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	user, err := app.getUser(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := app.store.APIKeys.Touch(ctx, key.ID, apiKeyTouchInterval); err != nil {
+		app.logger.Warnw("could not record API key use", "apiKeyID", key.ID, "error", err)
+	}
+	return key, user, nil
+}
+
+// RequireScopeMiddleware only lets requests through that are authenticated
+// with a session, or with an API key that has the scope. It must run after
+// AuthTokenMiddleware.
+func (app *application) RequireScopeMiddleware(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.hasScope(r.Context(), scope) {
+				app.forbiddenResponse(w, r, fmt.Errorf("%w: '%s'", ErrInsufficientScope, scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) hasScope(ctx context.Context, scope string) bool {
+	key := app.getAPIKeyFromCtx(ctx)
+	if key == nil {
+		return true
+	}
+	return scope != scopeAccount && slices.Contains(key.Scopes, scope)
+}
+
+func (app *application) getAPIKeyFromCtx(ctx context.Context) *store.APIKey {
+	key, _ := ctx.Value(apiKeyCtxKey).(*store.APIKey)
+	return key
+}
+
+// generateAPIKey returns a plain API key, and its hash to store.
+func generateAPIKey() (plainKey string, hashKey string, err error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+
+	plainKey = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	hash := sha256.Sum256([]byte(plainKey))
+	hashKey = hex.EncodeToString(hash[:])
+	return plainKey, hashKey, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Actions recorded in the audit log
+const (
+	auditLogin             = "auth.login"
+	auditLoginFailed       = "auth.login_failed"
+	auditAccountLocked     = "auth.account_locked"
+	auditPasswordChanged   = "user.password_changed"
+	auditPasswordReset     = "user.password_reset"
+	auditTwoFactorEnabled  = "user.2fa_enabled"
+	auditTwoFactorDisabled = "user.2fa_disabled"
+	auditAPIKeyCreated     = "api_key.created"
+	auditAPIKeyRevoked     = "api_key.revoked"
+	auditPostUpdated       = "post.updated"
+	auditPostDeleted       = "post.deleted"
+	auditCommentUpdated    = "comment.updated"
+	auditCommentDeleted    = "comment.deleted"
+	auditUserUnlocked      = "admin.user_unlocked"
+	auditUserRoleChanged   = "admin.user_role_changed"
+	auditUserBanned        = "admin.user_banned"
+	auditUserUnbanned      = "admin.user_unbanned"
+	auditUserActivated     = "admin.user_activated"
+	auditUserSignedOut     = "admin.user_signed_out"
+	auditPermissionGranted = "admin.permission_granted"
+	auditPermissionRevoked = "admin.permission_revoked"
+	auditReportResolved    = "moderation.report_resolved"
+)
+
+// Types of the targets of audit events
+const (
+	auditTargetUser    = "user"
+	auditTargetPost    = "post"
+	auditTargetComment = "comment"
+	auditTargetAPIKey  = "api_key"
+	auditTargetRole    = "role"
+	auditTargetReport  = "report"
+)
+
+// audit records an action of the authenticated user. See recordAudit.
+func (app *application) audit(r *http.Request, action string, targetType string, targetID int64, before any, after any) {
+	var actorID int64
+	if user := app.getAuthedUser(r.Context()); user != nil {
+		actorID = user.ID
+	}
+	app.recordAudit(r, actorID, action, targetType, targetID, before, after)
+}
+
+// auditOverride records an action on content owned by another user, which the
+// authenticated user could only take with a permission. Actions of the owner
+// are not recorded.
+func (app *application) auditOverride(r *http.Request, action string, targetType string, targetID int64, ownerID int64, before any, after any) {
+	if user := app.getAuthedUser(r.Context()); user == nil || user.ID == ownerID {
+		return
+	}
+	app.audit(r, action, targetType, targetID, before, after)
+}
+
+// recordAudit records an action in the audit log, with the request ID and IP
+// of the request. Only the fields that differ between before and after are
+// kept. The action has already happened, so a failure to record it is logged
+// instead of failing the request. An actor or target ID of 0 is stored as
+// unknown.
+func (app *application) recordAudit(r *http.Request, actorID int64, action string, targetType string, targetID int64, before any, after any) {
+	event := &store.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		RequestID:  middleware.GetReqID(r.Context()),
+		IP:         clientIP(r),
+	}
+	if actorID > 0 {
+		event.ActorID = &actorID
+	}
+	if targetID > 0 {
+		event.TargetID = &targetID
+	}
+
+	var err error
+	if event.Before, event.After, err = auditDiff(before, after); err != nil {
+		app.logger.Errorw("could not diff audit event", "action", action, "error", err)
+	}
+
+	if err := app.store.Audit.Record(r.Context(), event); err != nil {
+		app.logger.Errorw("could not record audit event", "action", action, "actorID", actorID, "targetID", targetID, "error", err)
+	}
+}
+
+// auditDiff marshals before and after to JSON objects, and drops the fields
+// that are the same in both. A nil side is left out.
+func auditDiff(before any, after any) (json.RawMessage, json.RawMessage, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if other, ok := afterFields[key]; ok && reflect.DeepEqual(value, other) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	beforeJSON, err := marshalAuditFields(beforeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterJSON, err := marshalAuditFields(afterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+func auditFields(v any) (map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func marshalAuditFields(fields map[string]any) (json.RawMessage, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+// getAuditEventsHandler godoc
+//
+//	@Summary		Lists audit events
+//	@Description	Lists the audit log of privileged and security relevant actions, newest first. Since and until are UTC times in the format 2006-01-02T15:04:05. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			admin
+//	@Produce		json
+//	@Param			actor_id	query		int		false	"ID of the user that acted"
+//	@Param			action		query		string	false	"Action, such as admin.user_banned"
+//	@Param			target_type	query		string	false	"One of user, post, comment, api_key, role and report"
+//	@Param			target_id	query		int		false	"ID of the target"
+//	@Param			since		query		string	false	"Since"
+//	@Param			until		query		string	false	"Until"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			cursor		query		string	false	"Cursor"
+//	@Param			sort		query		string	false	"Sort"
+//	@Success		200			{object}	PageResponse{data=[]AuditEvent}
+//	@Header			200			{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/audit-events [get]
+func (app *application) getAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pageable := store.Pageable{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "DESC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filter, err := new(store.AuditFilter).Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, filter); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	events, err := app.store.Audit.Search(ctx, filter, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, events.Items, newPageMeta(pageable, events)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
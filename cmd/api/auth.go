@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -18,6 +20,8 @@ var (
 	ErrUnauthorized = fmt.Errorf("unauthorized. please provide valid credentials")
 )
 
+const tokenClaimsCtxKey ctxKey = "tokenClaims"
+
 type RegisterUserRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=100"`
 	Email    string `json:"email" validate:"required,email,max=320"`
@@ -33,8 +37,8 @@ type RegisterUserRequest struct {
 //	@Produce		json
 //	@Param			payload	body		RegisterUserRequest	true	"User data"
 //	@Success		201		{object}	User				"User registered"
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Router			/auth/user [post]
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -74,20 +78,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
-	}
-
-	receipient := mailer.EmailData{
-		Name:  user.Username,
-		Email: user.Email,
-	}
-
-	response, err := app.mailer.Send(mailer.UserWelcomeTemplate, receipient, vars, (app.config.env != "production"))
+	response, err := app.sendActivationEmail(user, plainToken)
 	if err != nil {
 		app.logger.Errorw("could not send welcome email", "error", err, "user", user)
 
@@ -107,23 +98,106 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendActivationRequest struct {
+	Email string `json:"email" validate:"required,email,max=320"`
+}
+
 type CreateUserJWTRequest struct {
 	Email    string `json:"email" validate:"required,email,max=320"`
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=320"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+} //	@name	TokenResponse
+
+// resendActivationHandler godoc
+//
+//	@Summary		Resend activation email
+//	@Description	Issues a new invitation for an account that has not been activated yet. The response is the same whether or not the email belongs to such an account
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationRequest	true	"User email"
+//	@Success		202		{string}	string					"Activation email requested"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Router			/auth/activation/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ResendActivationRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// plain token to be used for email...
+	plainToken, hashedToken := app.generateToken()
+	user, err := app.store.Users.Reinvite(ctx, payload.Email, hashedToken, app.config.mail.inviteExpDuration)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			// Don't reveal whether the email belongs to an inactive account
+			app.logger.Infow("activation email requested for unknown or active account")
+			if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// A failure is only logged, as an error would reveal that the email
+	// belongs to an inactive account
+	if response, err := app.sendActivationEmail(user, plainToken); err != nil {
+		app.logger.Errorw("could not resend activation email", "error", err, "userID", user.ID)
+	} else {
+		app.logger.Infow("user invitation resent", "userID", user.ID, "email_response_code", response)
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 // createTokenHandler godoc
 //
 //	@Summary		Request a JWT token
-//	@Description	Request a JWT token for user authentication
+//	@Description	Request a short-lived JWT access token and a refresh token for user authentication. Repeated failures slow down further attempts, and lock the account for a while. Users with two-factor authentication get a challenge token to exchange at /auth/token/2fa instead
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserJWTRequest	true	"User credentials"
-//	@Success		201		{string}	string					"Token Created"
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		500		{object}	error
+//	@Success		201		{object}	TokenResponse				"Token Created"
+//	@Success		202		{object}	TwoFactorChallengeResponse	"Two-factor code required"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		429		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Router			/auth/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -139,12 +213,21 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ip := clientIP(r)
+	failures, ok := app.throttleLogin(w, r, payload.Email, ip)
+	if !ok {
+		return
+	}
+
 	// Fetch the user from the database, by username, to check the password
 	// against the stored hash
 	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
+			// Compare anyway, so unknown emails can't be told apart by timing
+			store.CompareDummyPassword(payload.Password)
+			app.recordLoginFailure(r, payload.Email, ip, nil, failures)
 			app.unauthorizedErrorResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -152,33 +235,402 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Check if the provided password matches the stored hash
-	if err := user.Password.Compare(payload.Password); err != nil {
+	// Check if the provided password matches the stored hash. Locked accounts
+	// get the same response as a wrong password.
+	if err := user.Password.Compare(payload.Password); err != nil || user.IsLocked() {
+		if err == nil {
+			err = errors.New("account is locked")
+		}
+		app.recordLoginFailure(r, payload.Email, ip, user, failures)
 		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
 
+	// Only tell banned users about the ban once the password is right
+	if user.IsBanned() {
+		app.forbiddenResponse(w, r, ErrUserBanned)
+		return
+	}
+
+	// Users with two-factor authentication get a challenge to complete with
+	// their code, and their failed attempts are only cleared once it is
+	totp, err := app.store.TwoFactor.Get(ctx, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if totp != nil && totp.Enabled() {
+		challenge, err := app.createLoginChallenge(r, user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.LoginAttempts.ClearFailures(ctx, user.Email); err != nil {
+		app.logger.Warnw("could not clear failed login attempts", "userID", user.ID, "error", err)
+	}
+
+	tokens, err := app.createSession(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.recordAudit(r, user.ID, auditLogin, auditTargetUser, user.ID, nil, map[string]any{"method": "password"})
+
+	// Send the tokens to the user
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refresh a JWT token
+//	@Description	Exchange a refresh token for a new access token. The refresh token is rotated, and can only be used once
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenRequest	true	"Refresh token"
+//	@Success		201		{object}	TokenResponse		"Token Created"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Router			/auth/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload RefreshTokenRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	plainToken, hashedToken := app.generateToken()
+	expireAt := time.Now().Add(app.config.auth.jwt.refreshExpiration)
+
+	session, err := app.store.Sessions.Rotate(ctx, payload.RefreshToken, hashedToken, uuid.New().String(), expireAt)
+	if err != nil {
+		switch err {
+		case store.ErrTokenReused:
+			app.logger.Warnw("refresh token reused, session revoked", "sessionID", session.ID, "userID", session.UserID)
+			if err := app.revokeAccessToken(ctx, session.AccessJTI); err != nil {
+				app.logger.Errorw("could not revoke access token", "sessionID", session.ID, "error", err)
+			}
+			app.unauthorizedErrorResponse(w, r, err)
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, errors.New("refresh token is invalid or expired"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// The user might have been deactivated, deleted or banned since the
+	// session started
+	user, err := app.getUser(ctx, session.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	} else if user.IsBanned() {
+		app.forbiddenResponse(w, r, ErrUserBanned)
+		return
+	}
+
+	tokens, err := app.newTokenResponse(session, plainToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// logoutHandler godoc
+//
+//	@Summary		Log out
+//	@Description	Revokes the session of the access token, including its refresh token
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		204	{string}	string	"Logged out"
+//	@Failure		401	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/auth/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	claims := app.getTokenClaimsFromCtx(ctx)
+	if user == nil || claims == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	if sessionID, ok := claims["sid"].(float64); ok {
+		if _, err := app.store.Sessions.Revoke(ctx, int64(sessionID), user.ID); err != nil && err != store.ErrNotFound {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	if err := app.revokeAccessToken(ctx, jti); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Request a password reset
+//	@Description	Emails a one-time password reset link to the user. The response is the same whether or not the email belongs to an account
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordRequest	true	"User email"
+//	@Success		202		{string}	string					"Password reset requested"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Router			/auth/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ForgotPasswordRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			// Don't reveal whether the email belongs to an account
+			app.logger.Infow("password reset requested for unknown email")
+			if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// plain token to be used for email...
+	plainToken, hashedToken := app.generateToken()
+	if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashedToken, app.config.mail.passwordResetExpDuration); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: app.config.mail.passwordResetExpDuration.String(),
+	}
+
+	receipient := mailer.EmailData{
+		Name:  user.Username,
+		Email: user.Email,
+	}
+
+	response, err := app.mailer.Send(mailer.PasswordResetTemplate, receipient, vars, (app.config.env != "production"))
+	if err != nil {
+		// Still accepted, as failing would reveal that the email belongs to an account
+		app.logger.Errorw("could not send password reset email", "error", err, "userID", user.ID)
+	} else {
+		app.logger.Infow("password reset email sent", "userID", user.ID, "email_response_code", response)
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Reset password
+//	@Description	Sets a new password using a password reset token, and signs the user out of all sessions
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResetPasswordRequest	true	"Reset token and new password"
+//	@Success		204		{string}	string					"Password reset"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Router			/auth/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ResetPasswordRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.ResetPassword(ctx, payload.Token, payload.Password)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, errors.New("password reset token not found or expired"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.revokeUserSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.recordAudit(r, user.ID, auditPasswordReset, auditTargetUser, user.ID, nil, nil)
+
+	app.logger.Infow("user password reset", "userID", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) sendActivationEmail(user *store.User, plainToken string) (string, error) {
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+	}
+
+	receipient := mailer.EmailData{
+		Name:  user.Username,
+		Email: user.Email,
+	}
+
+	return app.mailer.Send(mailer.UserWelcomeTemplate, receipient, vars, (app.config.env != "production"))
+}
+
+// createSession starts a new session for the user, and issues its first pair
+// of tokens.
+func (app *application) createSession(ctx context.Context, user *store.User) (*TokenResponse, error) {
+	plainToken, hashedToken := app.generateToken()
+
+	session := &store.Session{
+		UserID:    user.ID,
+		AccessJTI: uuid.New().String(),
+		ExpireAt:  time.Now().Add(app.config.auth.jwt.refreshExpiration),
+	}
+
+	if err := app.store.Sessions.Create(ctx, session, hashedToken); err != nil {
+		return nil, err
+	}
+
+	return app.newTokenResponse(session, plainToken)
+}
+
+func (app *application) newTokenResponse(session *store.Session, refreshToken string) (*TokenResponse, error) {
 	// Generate a new token, and add claims to it
 	iat := time.Now()
 	claims := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": session.UserID,
 		"exp": iat.Add(app.config.auth.jwt.expiration).Unix(),
 		"iat": iat.Unix(),
 		"nbf": iat.Unix(),
 		"iss": app.config.auth.jwt.issuer,
 		"aud": app.config.auth.jwt.issuer,
+		"jti": session.AccessJTI,
+		"sid": session.ID,
 	}
 
 	token, err := app.authenticator.GenerateToken(claims)
 	if err != nil {
-		app.internalServerError(w, r, err)
-		return
+		return nil, err
 	}
 
-	// Send the token to the user
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
-		app.internalServerError(w, r, err)
+	return &TokenResponse{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.jwt.expiration.Seconds()),
+	}, nil
+}
+
+// revokeAccessToken adds the token ID to the denylist for as long as any
+// access token issued now could still be valid.
+func (app *application) revokeAccessToken(ctx context.Context, jti string) error {
+	if jti == "" {
+		return nil
+	}
+
+	expireAt := time.Now().Add(app.config.auth.jwt.expiration)
+	if app.config.redis.Enabled() {
+		return app.cacheStorage.Tokens.Revoke(ctx, jti, expireAt)
+	}
+	return app.store.Sessions.RevokeToken(ctx, jti, expireAt)
+}
+
+// revokeUserSessions signs the user out everywhere, by revoking all sessions
+// and their current access tokens.
+func (app *application) revokeUserSessions(ctx context.Context, userID int64) error {
+	sessions, err := app.store.Sessions.RevokeAllByUserID(ctx, userID)
+	if err != nil {
+		return err
 	}
+
+	for _, session := range sessions {
+		if err := app.revokeAccessToken(ctx, session.AccessJTI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) isAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if app.config.redis.Enabled() {
+		return app.cacheStorage.Tokens.IsRevoked(ctx, jti)
+	}
+	return app.store.Sessions.IsTokenRevoked(ctx, jti)
+}
+
+func (app *application) getTokenClaimsFromCtx(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(tokenClaimsCtxKey).(jwt.MapClaims)
+	return claims
 }
 
 func (app *application) generateToken() (plainToken string, hashToken string) {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+var (
+	ErrUserBlocked    = errors.New("user is blocked")
+	ErrBlockSameUser  = errors.New("cannot block/mute yourself")
+	ErrUserNotBlocked = errors.New("user is not blocked")
+	ErrUserNotMuted   = errors.New("user is not muted")
+)
+
+// blockUserHandler godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID, and removes the follows between you. Blocked users can't follow each other, comment on each other's posts or view each other's profiles, and their comments are hidden from each other
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User blocked"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Block, nil)
+}
+
+// unblockUserHandler godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user by ID. Follows removed by the block are not restored
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User unblocked"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Unblock, ErrUserNotBlocked)
+}
+
+// muteUserHandler godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Mutes a user by ID, which hides their posts from your feed. The muted user is not told about it
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User muted"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Mute, nil)
+}
+
+// unmuteUserHandler godoc
+//
+//	@Summary		Unmutes a user
+//	@Description	Unmutes a user by ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"User unmuted"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Unmute, ErrUserNotMuted)
+}
+
+type userRelationFunc func(ctx context.Context, userID int64, otherID int64) error
+
+// updateUserRelation blocks, mutes or undoes either for the user of the URL.
+// A store.ErrNotFound from undoing is reported as notFoundErr, and from
+// blocking or muting as an unknown user.
+func (app *application) updateUserRelation(w http.ResponseWriter, r *http.Request, update userRelationFunc, notFoundErr error) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	userID, err := app.GetIDFromURL(ctx)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	} else if authUser.ID == userID {
+		app.badRequestResponse(w, r, ErrBlockSameUser)
+		return
+	}
+
+	if err := update(ctx, authUser.ID, userID); err != nil {
+		switch {
+		case err == store.ErrNotFound && notFoundErr != nil:
+			app.notFoundResponse(w, r, notFoundErr)
+		case err == store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		case err == store.ErrConflict:
+			app.badRequestResponse(w, r, ErrBlockSameUser)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkNotBlocked writes a forbidden response and returns false when the
+// authenticated user and the user have blocked each other, in either
+// direction.
+func (app *application) checkNotBlocked(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil || authUser.ID == userID {
+		return true
+	}
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, authUser.ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return false
+	} else if blocked {
+		app.forbiddenResponse(w, r, ErrUserBlocked)
+		return false
+	}
+	return true
+}
+
+// withoutBlockedComments leaves out the comments of users that the user has
+// blocked or been blocked by. The first page of comments is cached for all
+// users, so blocks are applied to the fetched page.
+func (app *application) withoutBlockedComments(ctx context.Context, userID int64, comments []store.Comment) ([]store.Comment, error) {
+	blockedIDs, err := app.store.Blocks.GetBlockedIDs(ctx, userID)
+	if err != nil || len(blockedIDs) == 0 {
+		return comments, err
+	}
+
+	blocked := make(map[int64]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+
+	visible := make([]store.Comment, 0, len(comments))
+	for _, comment := range comments {
+		if !blocked[comment.UserID] {
+			visible = append(visible, comment)
+		}
+	}
+	return visible, nil
+}
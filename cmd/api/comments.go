@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+const commentCtxKey ctxKey = "comment"
+
+// firstCommentsPage is the page of top-level comments embedded in a post, and
+// the only page of comments kept in the cache.
+var firstCommentsPage = store.Pageable{
+	Limit:  10,
+	Offset: 0,
+	Sort:   "DESC",
+}
+
+type CreateCommentRequest struct {
+	Content  string `json:"content" validate:"required,min=1,max=1000"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gte=1"`
+} //	@name	CreateCommentRequest
+
+type UpdateCommentRequest struct {
+	Content string `json:"content" validate:"required,min=1,max=1000"`
+} //	@name	UpdateCommentRequest
+
+// getPostCommentsHandler godoc
+//
+//	@Summary		Fetches the comments of a post
+//	@Description	Fetches a page of the top-level comments of a post
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	PageResponse{data=[]Comment}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments [get]
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	post := app.getPostFromCtx(ctx)
+	if post == nil {
+		app.internalServerError(w, r, errors.New("could not find post"))
+		return
+	}
+
+	pageable := firstCommentsPage.Parse(r)
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var (
+		comments *store.Page[store.Comment]
+		err      error
+	)
+	if pageable == firstCommentsPage {
+		comments, err = app.getPostComments(ctx, post.ID)
+	} else {
+		comments, err = app.store.Comments.GetByPostID(ctx, post.ID, &pageable)
+	}
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	items, err := app.withoutBlockedComments(ctx, app.getAuthedUser(ctx).ID, comments.Items)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, items, newPageMeta(pageable, comments)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getCommentRepliesHandler godoc
+//
+//	@Summary		Fetches the replies to a comment
+//	@Description	Fetches a page of the direct replies to a comment
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			cursor		query		string	false	"Cursor"
+//	@Param			sort		query		string	false	"Sort"
+//	@Success		200			{object}	PageResponse{data=[]Comment}
+//	@Header			200			{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments/{commentID}/replies [get]
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	comment := app.getCommentFromCtx(ctx)
+	if comment == nil {
+		app.internalServerError(w, r, errors.New("could not find comment"))
+		return
+	}
+
+	pageable := store.Pageable{
+		Limit:  10,
+		Offset: 0,
+		Sort:   "ASC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	replies, err := app.store.Comments.GetReplies(ctx, comment.ID, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	items, err := app.withoutBlockedComments(ctx, app.getAuthedUser(ctx).ID, replies.Items)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	meta := newPageMeta(pageable, replies)
+	meta.Total = &comment.RepliesCount
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, items, meta); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createCommentHandler godoc
+//
+//	@Summary		Creates a comment
+//	@Description	Creates a comment on a post, or a reply to a comment when parent_id is set
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentRequest	true	"Comment request payload"
+//	@Success		201		{object}	Comment
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	post := app.getPostFromCtx(ctx)
+	if post == nil {
+		app.internalServerError(w, r, errors.New("could not find post"))
+		return
+	}
+
+	var payload CreateCommentRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.checkNotBlocked(w, r, post.UserID) {
+		return
+	}
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *payload.ParentID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.badRequestResponse(w, r, fmt.Errorf("parent comment with ID '%d' does not exist", *payload.ParentID))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if parent.PostID != post.ID {
+			app.badRequestResponse(w, r, fmt.Errorf("parent comment with ID '%d' does not belong to post with ID '%d'", parent.ID, post.ID))
+			return
+		}
+
+		if !app.checkNotBlocked(w, r, parent.UserID) {
+			return
+		}
+	}
+
+	comment := &store.Comment{
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		UserID:   authUser.ID,
+		Content:  payload.Content,
+		User: store.User{
+			BaseEntity: store.BaseEntity{ID: authUser.ID},
+			Username:   authUser.Username,
+		},
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.updateCachedComments(ctx, comment.PostID, func(comments *store.Page[store.Comment]) {
+		if comment.ParentID != nil {
+			adjustRepliesCount(comments.Items, *comment.ParentID, 1)
+			return
+		}
+
+		comments.Items = append([]store.Comment{*comment}, comments.Items...)
+		if len(comments.Items) > firstCommentsPage.Limit {
+			comments.Items = comments.Items[:firstCommentsPage.Limit]
+
+			last := comments.Items[len(comments.Items)-1]
+			comments.NextCursor = store.NewCursor(last.CreatedAt, last.ID).Encode()
+			comments.HasMore = true
+		}
+	})
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateCommentHandler godoc
+//
+//	@Summary		Updates a comment
+//	@Description	Updates a comment on a post by ID
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			payload		body		UpdateCommentRequest	true	"Comment request payload"
+//	@Success		200			{object}	Comment
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		401			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	comment := app.getCommentFromCtx(ctx)
+	if comment == nil {
+		app.internalServerError(w, r, errors.New("could not find comment"))
+		return
+	}
+
+	var payload UpdateCommentRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := *comment
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(ctx, comment); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, fmt.Errorf("comment with ID '%d' does not exist", comment.ID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.updateCachedComments(ctx, comment.PostID, func(comments *store.Page[store.Comment]) {
+		for i := range comments.Items {
+			if comments.Items[i].ID == comment.ID {
+				comments.Items[i] = *comment
+				break
+			}
+		}
+	})
+
+	app.auditOverride(r, auditCommentUpdated, auditTargetComment, comment.ID, comment.UserID, before, comment)
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCommentHandler godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Deletes a comment on a post by ID
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		204			{object}	string
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	comment := app.getCommentFromCtx(ctx)
+	if comment == nil {
+		app.internalServerError(w, r, errors.New("could not find comment"))
+		return
+	}
+
+	if err := app.store.Comments.Delete(ctx, comment.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, fmt.Errorf("comment with ID '%d' does not exist", comment.ID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if comment.ParentID != nil {
+		app.updateCachedComments(ctx, comment.PostID, func(comments *store.Page[store.Comment]) {
+			adjustRepliesCount(comments.Items, *comment.ParentID, -1)
+		})
+	} else if app.config.redis.Enabled() {
+		// The cached first page can't be refilled from the cache alone, so it is
+		// dropped and rebuilt from the DB on the next read.
+		if err := app.cacheStorage.Comments.DeleteByPostID(ctx, comment.PostID); err != nil {
+			app.logger.Warnw("could not delete comments from cache", "postID", comment.PostID, "error", err)
+		}
+	}
+
+	app.auditOverride(r, auditCommentDeleted, auditTargetComment, comment.ID, comment.UserID, map[string]any{"user_id": comment.UserID, "post_id": comment.PostID, "content": comment.Content}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) addCommentToCtxMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		post := app.getPostFromCtx(ctx)
+		if post == nil {
+			app.internalServerError(w, r, errors.New("could not find post"))
+			return
+		}
+
+		commentID, err := app.GetInt64URLParam(ctx, "commentID")
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("missing comment ID"))
+			return
+		}
+
+		comment, err := app.store.Comments.GetByID(ctx, commentID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.notFoundResponse(w, r, fmt.Errorf("comment with ID '%d' was not found", commentID))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if comment.PostID != post.ID || comment.HiddenAt != nil && !app.canSeeHidden(ctx, comment.UserID) {
+			app.notFoundResponse(w, r, fmt.Errorf("comment with ID '%d' was not found on post with ID '%d'", commentID, post.ID))
+			return
+		}
+
+		commentCtx := context.WithValue(ctx, commentCtxKey, comment)
+		next.ServeHTTP(w, r.WithContext(commentCtx))
+	})
+}
+
+// updateCachedComments applies fn to the cached first page of comments of a
+// post. Nothing is cached if the comments are not already in cache.
+func (app *application) updateCachedComments(ctx context.Context, postID int64, fn func(*store.Page[store.Comment])) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	comments, err := app.cacheStorage.Comments.GetByPostID(ctx, postID)
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			app.logger.Warnw("could not get comments from cache", "postID", postID, "error", err)
+		}
+		return
+	}
+
+	fn(comments)
+	if err := app.cacheStorage.Comments.SetByPostID(ctx, postID, comments); err != nil {
+		app.logger.Warnw("could not set comments in cache", "postID", postID, "error", err)
+	}
+}
+
+func adjustRepliesCount(comments []store.Comment, parentID int64, delta int) {
+	for i := range comments {
+		if comments[i].ID == parentID {
+			comments[i].RepliesCount += delta
+			break
+		}
+	}
+}
+
+func (app *application) getCommentFromCtx(ctx context.Context) *store.Comment {
+	comment, _ := ctx.Value(commentCtxKey).(*store.Comment)
+	return comment
+}
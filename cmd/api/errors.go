@@ -1,41 +1,224 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/auth"
+	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes are part of the API contract. Clients match on them, so they
+// must never change once released.
+const (
+	codeInternalError    = "internal_error"
+	codeBadRequest       = "bad_request"
+	codeValidationFailed = "validation_failed"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeRateLimited      = "rate_limited"
 )
 
+// errorCodes are the codes of known errors that are more specific than the
+// code of the response they are sent with.
+var errorCodes = map[error]string{
+	ErrInvalidParameter:        "invalid_parameter",
+	ErrUserNotFound:            "user_not_found",
+	ErrUserAlreadyFollowed:     "user_already_followed",
+	ErrUserAlreadyUnfollowed:   "user_already_unfollowed",
+	ErrFollowSameUser:          "follow_same_user",
+	ErrFollowAlreadyRequested:  "follow_already_requested",
+	ErrFollowRequestNotFound:   "follow_request_not_found",
+	ErrAlreadyFollower:         "already_follower",
+	ErrInvalidReactionType:     "invalid_reaction_type",
+	store.ErrInvalidCursor:     "invalid_cursor",
+	store.ErrDuplicateEmail:    "duplicate_email",
+	store.ErrDuplicateUsername: "duplicate_username",
+	store.ErrDirtyRecord:       "edit_conflict",
+	store.ErrTokenReused:       "token_reused",
+
+	ErrTwoFactorAlreadyEnabled: "two_factor_already_enabled",
+	ErrTwoFactorNotEnabled:     "two_factor_not_enabled",
+	ErrTwoFactorNotEnrolled:    "two_factor_not_enrolled",
+	ErrInvalidTwoFactorCode:    "invalid_two_factor_code",
+	ErrInvalidChallenge:        "invalid_challenge",
+
+	auth.ErrUnknownProvider:  "unknown_identity_provider",
+	ErrInvalidOIDCState:      "invalid_oidc_state",
+	ErrEmailNotVerified:      "email_not_verified",
+	ErrIdentityAlreadyLinked: "identity_already_linked",
+
+	ErrTooManyAPIKeys:    "too_many_api_keys",
+	ErrInvalidAPIKey:     "invalid_api_key",
+	ErrInsufficientScope: "insufficient_scope",
+
+	ErrMissingPermission: "missing_permission",
+	ErrRoleNotFound:      "role_not_found",
+	ErrRoleAboveOwn:      "role_above_own",
+	ErrPermissionNotHeld: "permission_not_held",
+
+	ErrUserBanned:         "user_banned",
+	ErrUserRoleNotBelow:   "user_role_not_below",
+	ErrAssignRoleAboveOwn: "assign_role_above_own",
+
+	ErrReportOwnContent: "report_own_content",
+	ErrAlreadyReported:  "already_reported",
+	ErrReportResolved:   "report_resolved",
+
+	ErrUserBlocked:    "user_blocked",
+	ErrBlockSameUser:  "block_same_user",
+	ErrUserNotBlocked: "user_not_blocked",
+	ErrUserNotMuted:   "user_not_muted",
+}
+
+// ProblemDetails is an error response as described in RFC 7807.
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+} //	@name	ProblemDetails
+
+// FieldError is a validation failure of a single field. Tag is the failing
+// validation rule, and Param its parameter, like the 8 of min=8.
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+} //	@name	FieldError
+
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorw("internal server error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+	app.writeProblem(w, r, http.StatusInternalServerError, codeInternalError, "the server encountered a problem and could not process your request")
 }
 
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorw("conflict error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusConflict, err.Error())
+	app.writeProblem(w, r, http.StatusConflict, errorCode(err, codeConflict), err.Error())
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("bad request error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusBadRequest, err.Error())
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		app.writeProblem(w, r, http.StatusBadRequest, codeValidationFailed, "the request is invalid", fieldErrors(validationErrors)...)
+		return
+	}
+
+	app.writeProblem(w, r, http.StatusBadRequest, errorCode(err, codeBadRequest), err.Error())
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusNotFound, err.Error())
+	app.writeProblem(w, r, http.StatusNotFound, errorCode(err, codeNotFound), err.Error())
 }
 
 func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	app.writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 }
 
 func (app *application) unauthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("unauthorized basic error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted", charset="UTF-8"`)
-	_ = writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	app.writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 }
 
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("forbidden error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	_ = writeJSONError(w, http.StatusForbidden, "forbidden")
+	app.writeProblem(w, r, http.StatusForbidden, errorCode(err, codeForbidden), "forbidden")
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path, "retry_after", retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	app.writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded, retry after "+retryAfter.Round(time.Second).String())
+}
+
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string, fieldErrors ...FieldError) {
+	problem := ProblemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+		Errors:    fieldErrors,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&problem); err != nil {
+		app.logger.Errorw("could not write error response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	}
+}
+
+// errorCode returns the code of a known error, or the fallback code of the
+// response.
+func errorCode(err error, fallback string) string {
+	for knownErr, code := range errorCodes {
+		if errors.Is(err, knownErr) {
+			return code
+		}
+	}
+	return fallback
+}
+
+func fieldErrors(validationErrors validator.ValidationErrors) []FieldError {
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		// The namespace starts with the name of the validated struct
+		field := fe.Namespace()
+		if _, path, found := strings.Cut(field, "."); found {
+			field = path
+		}
+
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Tag:     fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return fieldErrors
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s long", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s long", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	case "http_url", "url":
+		return "must be a valid URL"
+	default:
+		return fmt.Sprintf("failed on the '%s' rule", fe.Tag())
+	}
 }
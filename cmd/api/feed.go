@@ -9,7 +9,7 @@ import (
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
@@ -17,12 +17,14 @@ import (
 //	@Param			until	query		string	false	"Until"
 //	@Param			limit	query		int		false	"Limit"
 //	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
 //	@Param			sort	query		string	false	"Sort"
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]PostWithMetadata
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Success		200		{object}	PageResponse{data=[]PostWithMetadata}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,12 +53,32 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, &pageable, filter)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	postIDs := make([]int64, len(feed.Items))
+	for i, post := range feed.Items {
+		postIDs[i] = post.ID
+	}
+
+	reactions, err := app.getReactionCounts(ctx, postIDs)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	for i := range feed.Items {
+		feed.Items[i].Reactions = reactions[feed.Items[i].ID]
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, feed.Items, newPageMeta(pageable, feed)); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
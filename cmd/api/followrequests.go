@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+// getFollowRequestsHandler godoc
+//
+//	@Summary		Fetches the pending follow requests
+//	@Description	Fetches the users that have requested to follow the authenticated user, newest first. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	PageResponse{data=[]FollowRequest}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	pageable := store.Pageable{
+		Limit: 20,
+		Sort:  "DESC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	requests, err := app.store.Follow.GetRequests(ctx, authUser.ID, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, requests.Items, newPageMeta(pageable, requests)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// approveFollowRequestHandler godoc
+//
+//	@Summary		Approves a follow request
+//	@Description	Approves the request of a user to follow the authenticated user. Requests between users that have blocked each other, or of users that already follow, are dropped with an error
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"ID of the requesting user"
+//	@Success		204	{string}	string	"Follow request approved"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		409	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{id} [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Follow.ApproveRequest)
+}
+
+// rejectFollowRequestHandler godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Rejects the request of a user to follow the authenticated user. The user is not told about it
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"ID of the requesting user"
+//	@Success		204	{string}	string	"Follow request rejected"
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{id} [delete]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Follow.RejectRequest)
+}
+
+// answerFollowRequest approves or rejects the follow request of the user of
+// the URL.
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer userRelationFunc) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	requesterID, err := app.GetIDFromURL(ctx)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := answer(ctx, authUser.ID, requesterID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrFollowRequestNotFound)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r, ErrUserBlocked)
+		case store.ErrAlreadyExists:
+			app.conflictResponse(w, r, ErrAlreadyFollower)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runCleanupJob periodically purges expired invitations, password resets,
+// sessions, login challenges, sign in requests and failed login attempts,
+// audit events past their retention, and users that never activated their
+// account. It runs until the context is cancelled.
+func (app *application) runCleanupJob(ctx context.Context) {
+	if app.config.jobs.cleanupInterval <= 0 {
+		app.logger.Warnln("cleanup job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(app.config.jobs.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		app.cleanup(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) cleanup(ctx context.Context) {
+	logger := app.logger.Named("jobs").With("job", "cleanup")
+
+	if n, err := app.store.Users.PurgeExpiredInvitations(ctx); err != nil {
+		logger.Errorw("could not purge expired invitations", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged expired invitations", "count", n)
+	}
+
+	if n, err := app.store.Users.PurgeUnactivated(ctx, app.config.jobs.unactivatedUserGrace); err != nil {
+		logger.Errorw("could not purge unactivated users", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged unactivated users", "count", n)
+	}
+
+	if n, err := app.store.Users.PurgeExpiredPasswordResets(ctx); err != nil {
+		logger.Errorw("could not purge expired password resets", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged expired password resets", "count", n)
+	}
+
+	if n, err := app.store.Sessions.PurgeExpired(ctx); err != nil {
+		logger.Errorw("could not purge expired sessions", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged expired sessions", "count", n)
+	}
+
+	if n, err := app.store.LoginAttempts.PurgeBefore(ctx, time.Now().Add(-app.config.auth.login.failureWindow)); err != nil {
+		logger.Errorw("could not purge failed login attempts", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged failed login attempts", "count", n)
+	}
+
+	if n, err := app.store.TwoFactor.PurgeExpiredChallenges(ctx); err != nil {
+		logger.Errorw("could not purge expired login challenges", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged expired login challenges", "count", n)
+	}
+
+	if n, err := app.store.Identities.PurgeExpiredAuthRequests(ctx); err != nil {
+		logger.Errorw("could not purge expired sign in requests", "error", err)
+	} else if n > 0 {
+		logger.Infow("purged expired sign in requests", "count", n)
+	}
+
+	if retention := app.config.jobs.auditRetention; retention > 0 {
+		if n, err := app.store.Audit.PurgeBefore(ctx, time.Now().Add(-retention)); err != nil {
+			logger.Errorw("could not purge old audit events", "error", err)
+		} else if n > 0 {
+			logger.Infow("purged old audit events", "count", n)
+		}
+	}
+}
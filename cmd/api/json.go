@@ -2,8 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/addvanced/gophersocial/internal/store"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -11,6 +17,15 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their JSON names, which are the names clients know
+	Validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -29,17 +44,94 @@ func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) error {
+func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
 	type envelope struct {
-		Error string `json:"error"`
+		Data any `json:"data"`
 	}
+	return writeJSON(w, status, &envelope{Data: data})
+}
+
+// PageMeta describes the page of a list response. Offset is set for pages
+// fetched by offset, and Cursor for pages fetched by cursor.
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int   `json:"total,omitempty"`
+} //	@name	PageMeta
 
-	return writeJSON(w, status, &envelope{Error: message})
+func newPageMeta[T any](pageable store.Pageable, page *store.Page[T]) PageMeta {
+	meta := PageMeta{
+		Limit:      pageable.Limit,
+		Cursor:     pageable.Cursor,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		HasMore:    page.HasMore,
+	}
+	if pageable.Cursor == "" {
+		meta.Offset = &pageable.Offset
+	}
+	return meta
 }
 
-func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
-	type envelope struct {
-		Data any `json:"data"`
+// PageResponse is the body of list responses. Data holds the items of the
+// page.
+type PageResponse struct {
+	Data any      `json:"data"`
+	Meta PageMeta `json:"meta"`
+} //	@name	PageResponse
+
+// jsonPageResponse writes a page of a list with its metadata, and links to
+// the first, previous and next pages in a Link header (RFC 8288).
+func (app *application) jsonPageResponse(w http.ResponseWriter, r *http.Request, status int, data any, meta PageMeta) error {
+	if links := pageLinks(r, meta); len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
 	}
-	return writeJSON(w, status, &envelope{Data: data})
+	return writeJSON(w, status, &PageResponse{Data: data, Meta: meta})
+}
+
+func pageLinks(r *http.Request, meta PageMeta) []string {
+	link := func(rel string, set func(url.Values)) string {
+		q := r.URL.Query()
+		q.Del("cursor")
+		q.Del("offset")
+		set(q)
+
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	links := []string{link("first", func(url.Values) {})}
+
+	// Pages fetched by offset keep linking by offset, so clients that have not
+	// moved to cursors see the same pages.
+	if meta.Offset != nil {
+		offset := *meta.Offset
+		if offset > 0 {
+			links = append(links, link("prev", func(q url.Values) {
+				q.Set("offset", strconv.Itoa(max(offset-meta.Limit, 0)))
+			}))
+		}
+		if meta.HasMore {
+			links = append(links, link("next", func(q url.Values) {
+				q.Set("offset", strconv.Itoa(offset+meta.Limit))
+			}))
+		}
+		return links
+	}
+
+	if meta.PrevCursor != "" {
+		links = append(links, link("prev", func(q url.Values) {
+			q.Set("cursor", meta.PrevCursor)
+		}))
+	}
+	if meta.NextCursor != "" {
+		links = append(links, link("next", func(q url.Values) {
+			q.Set("cursor", meta.NextCursor)
+		}))
+	}
+	return links
 }
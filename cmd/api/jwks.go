@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/auth"
+)
+
+// jwksHandler godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Public keys for verifying the tokens issued by the API. Empty when tokens are signed with a shared secret
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKSet
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	keySet := auth.JWKSet{Keys: []auth.JWK{}}
+	if provider, ok := app.authenticator.(auth.KeySetProvider); ok {
+		keySet = provider.KeySet()
+	}
+
+	// Served without the data envelope, as clients expect a plain JWK Set
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, keySet); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
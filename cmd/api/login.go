@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/mailer"
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+// throttleLogin slows down login attempts after failures, and rejects them
+// when too many have failed from the same IP. It writes the error response
+// and returns false when the attempt is rejected.
+func (app *application) throttleLogin(w http.ResponseWriter, r *http.Request, email string, ip string) (*store.LoginFailures, bool) {
+	ctx := r.Context()
+	cfg := app.config.auth.login
+
+	failures, err := app.store.LoginAttempts.CountFailures(ctx, email, ip, time.Now().Add(-cfg.failureWindow))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+
+	if failures.IP >= cfg.maxIPFailures {
+		app.rateLimitExceededResponse(w, r, cfg.failureWindow)
+		return nil, false
+	}
+
+	delay := app.loginDelay(max(failures.Account, failures.IP))
+	if delay <= 0 {
+		return failures, true
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-time.After(delay):
+		return failures, true
+	}
+}
+
+// loginDelay doubles for every failed attempt, up to the configured maximum.
+func (app *application) loginDelay(failures int) time.Duration {
+	cfg := app.config.auth.login
+	if failures <= 0 || cfg.baseDelay <= 0 {
+		return 0
+	}
+
+	delay := cfg.baseDelay
+	for i := 1; i < failures && delay < cfg.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, cfg.maxDelay)
+}
+
+// recordLoginFailure records a failed login attempt, and locks the account of
+// the user once it has failed too often. The user is nil for unknown emails.
+func (app *application) recordLoginFailure(r *http.Request, email string, ip string, user *store.User, failures *store.LoginFailures) {
+	ctx := r.Context()
+	cfg := app.config.auth.login
+
+	if err := app.store.LoginAttempts.RecordFailure(ctx, email, ip); err != nil {
+		app.logger.Errorw("could not record failed login attempt", "ip", ip, "error", err)
+	}
+
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	app.recordAudit(r, 0, auditLoginFailed, auditTargetUser, userID, nil, map[string]any{"email": email})
+
+	if user == nil || user.IsLocked() || failures.Account+1 < cfg.maxAccountFailures {
+		return
+	}
+
+	if err := app.store.Users.Lock(ctx, user.ID, time.Now().Add(cfg.lockoutDuration)); err != nil {
+		app.logger.Errorw("could not lock user", "userID", user.ID, "error", err)
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+	app.recordAudit(r, 0, auditAccountLocked, auditTargetUser, user.ID, nil, map[string]any{"failures": failures.Account + 1})
+	app.logger.Warnw("user locked after failed login attempts", "userID", user.ID, "ip", ip, "failures", failures.Account+1)
+
+	vars := struct {
+		Username  string
+		LockedFor string
+		ResetURL  string
+	}{
+		Username:  user.Username,
+		LockedFor: cfg.lockoutDuration.String(),
+		ResetURL:  fmt.Sprintf("%s/password/forgot", app.config.frontendURL),
+	}
+
+	receipient := mailer.EmailData{
+		Name:  user.Username,
+		Email: user.Email,
+	}
+
+	response, err := app.mailer.Send(mailer.AccountLockedTemplate, receipient, vars, (app.config.env != "production"))
+	if err != nil {
+		app.logger.Errorw("could not send account locked email", "userID", user.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("account locked email sent", "userID", user.ID, "email_response_code", response)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
 	"os/signal"
 	"syscall"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"github.com/addvanced/gophersocial/internal/db"
 	"github.com/addvanced/gophersocial/internal/env"
 	"github.com/addvanced/gophersocial/internal/mailer"
+	"github.com/addvanced/gophersocial/internal/ratelimiter"
 	"github.com/addvanced/gophersocial/internal/store"
 	"github.com/addvanced/gophersocial/internal/store/cache"
 	"github.com/go-redis/redis/v8"
@@ -32,9 +35,18 @@ const VERSION = "0.0.1"
 //	@tag.name			posts
 //	@tag.description	Operations related to managing posts
 //
+//	@tag.name			comments
+//	@tag.description	Operations related to managing comments on posts
+//
 //	@tag.name			feed
 //	@tag.description	Operations related to the user feed
 //
+//	@tag.name			admin
+//	@tag.description	Administrative operations on users and content
+//
+//	@tag.name			moderation
+//	@tag.description	Review of reported posts and comments
+//
 //	@tag.name			ops
 //	@tag.description	OPS Specific operations
 //
@@ -63,7 +75,8 @@ func main() {
 				fromEmail: env.GetString("RESEND_FROM_EMAIL", env.GetString("EMAIL_FROM_EMAIL", "kenneth@addvanced.dk")),
 				apiKey:    env.GetString("RESEND_API_KEY", ""),
 			},
-			inviteExpDuration: env.GetDuration("USER_INVITE_EXPIRE", time.Hour*24*3),
+			inviteExpDuration:        env.GetDuration("USER_INVITE_EXPIRE", time.Hour*24*3),
+			passwordResetExpDuration: env.GetDuration("PASSWORD_RESET_EXPIRE", time.Hour),
 		},
 		auth: authConfig{
 			basic: basicAuthConfig{
@@ -71,9 +84,31 @@ func main() {
 				password: env.GetString("BASIC_AUTH_PASSWORD", "admin"),
 			},
 			jwt: jwtAuthConfig{
-				secret:     env.GetString("JWT_TOKEN_SECRET", "example"),
-				issuer:     env.GetString("JWT_TOKEN_ISSUER", "gophersocial"),
-				expiration: env.GetDuration("JWT_TOKEN_EXPIRE", time.Hour*24*3),
+				secret:            env.GetString("JWT_TOKEN_SECRET", "example"),
+				issuer:            env.GetString("JWT_TOKEN_ISSUER", "gophersocial"),
+				expiration:        env.GetDuration("JWT_TOKEN_EXPIRE", time.Minute*15),
+				refreshExpiration: env.GetDuration("JWT_REFRESH_TOKEN_EXPIRE", time.Hour*24*30),
+
+				signingKeyFile:       env.GetString("JWT_SIGNING_KEY_FILE", ""),
+				signingKeyID:         env.GetString("JWT_SIGNING_KEY_ID", ""),
+				verificationKeyFiles: env.GetStringSlice("JWT_VERIFICATION_KEY_FILES", nil),
+			},
+			login: loginConfig{
+				maxAccountFailures: env.GetInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+				maxIPFailures:      env.GetInt("LOGIN_MAX_IP_FAILURES", 50),
+				failureWindow:      env.GetDuration("LOGIN_FAILURE_WINDOW", time.Minute*15),
+				lockoutDuration:    env.GetDuration("LOGIN_LOCKOUT_DURATION", time.Minute*15),
+				baseDelay:          env.GetDuration("LOGIN_DELAY_BASE", time.Millisecond*250),
+				maxDelay:           env.GetDuration("LOGIN_DELAY_MAX", time.Second*5),
+			},
+			totp: totpConfig{
+				issuer:               env.GetString("TOTP_ISSUER", "GopherSocial"),
+				challengeExpiration:  env.GetDuration("TOTP_CHALLENGE_EXPIRE", time.Minute*5),
+				maxChallengeAttempts: env.GetInt("TOTP_CHALLENGE_MAX_ATTEMPTS", 5),
+			},
+			oidc: oidcConfig{
+				providers:             oidcProvidersFromEnv(),
+				authRequestExpiration: env.GetDuration("OIDC_AUTH_REQUEST_EXPIRE", time.Minute*10),
 			},
 		},
 		db: db.NewPostgresConfig(
@@ -97,6 +132,25 @@ func main() {
 			env.GetDuration("REDIS_TTL_USERS", env.GetDuration("REDIS_TTL", time.Minute)),
 			env.GetDuration("REDIS_TTL_POSTS", env.GetDuration("REDIS_TTL", time.Minute)),
 		),
+		moderation: moderationConfig{
+			reportHideThreshold: env.GetInt("REPORT_HIDE_THRESHOLD", 5),
+		},
+		jobs: jobsConfig{
+			cleanupInterval:      env.GetDuration("JOB_CLEANUP_INTERVAL", time.Hour),
+			unactivatedUserGrace: env.GetDuration("UNACTIVATED_USER_GRACE_PERIOD", time.Hour*24*7),
+			auditRetention:       env.GetDuration("AUDIT_RETENTION", time.Hour*24*365),
+		},
+		rateLimit: rateLimitConfig{
+			enabled:  env.GetBool("RATE_LIMIT_ENABLED", true),
+			api:      rateLimitFromEnv("API", 300, time.Minute),
+			auth:     rateLimitFromEnv("AUTH", 30, time.Minute),
+			token:    rateLimitFromEnv("TOKEN", 5, time.Minute),
+			posts:    rateLimitFromEnv("POSTS", 10, time.Minute),
+			comments: rateLimitFromEnv("COMMENTS", 30, time.Minute),
+		},
+		posts: postsConfig{
+			reactionTypes: env.GetStringSlice("REACTION_TYPES", []string{"like", "love", "laugh", "wow", "sad", "angry"}),
+		},
 	}
 
 	// Logger
@@ -124,6 +178,11 @@ func main() {
 		logger.Warnln("Redis cache is disabled")
 	}
 
+	cfg.trustedProxies, err = parseTrustedProxies(env.GetStringSlice("TRUSTED_PROXIES", nil))
+	if err != nil {
+		logger.Fatalw("invalid trusted proxies", "error", err.Error())
+	}
+
 	store := store.NewStorage(db, logger)
 	cacheStore := cache.NewRedisStorage(&cfg.redis, rdsDB)
 
@@ -133,11 +192,21 @@ func main() {
 		cfg.mail.resend.apiKey,
 	)
 
-	jwtAuthenticator := auth.NewJWTAuthenticator(
-		cfg.auth.jwt.secret,
-		cfg.auth.jwt.issuer,
-		cfg.auth.jwt.issuer,
-	)
+	// Rate limiting is shared by all instances through Redis when it is enabled
+	var rateLimiter ratelimiter.Limiter = ratelimiter.NewFixedWindowLimiter()
+	if cfg.redis.Enabled() {
+		rateLimiter = ratelimiter.NewRedisLimiter(rdsDB)
+	}
+
+	jwtAuthenticator, err := newAuthenticator(&cfg.auth.jwt)
+	if err != nil {
+		logger.Fatalw("could not create authenticator", "error", err.Error())
+	}
+
+	identityProviders, err := newIdentityProviders(&cfg)
+	if err != nil {
+		logger.Fatalw("could not create identity providers", "error", err.Error())
+	}
 
 	app := &application{
 		config:        cfg,
@@ -145,9 +214,66 @@ func main() {
 		cacheStorage:  cacheStore,
 		mailer:        mailer,
 		authenticator: jwtAuthenticator,
+		rateLimiter:   rateLimiter,
 		logger:        logger,
+
+		identityProviders: identityProviders,
 	}
 
+	go app.runCleanupJob(ctx)
+
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+// newAuthenticator creates an RS256/EdDSA authenticator when a signing key file
+// is configured, and falls back to HS256 with the shared secret otherwise.
+func newAuthenticator(cfg *jwtAuthConfig) (auth.Authenticator, error) {
+	if cfg.signingKeyFile == "" {
+		return auth.NewJWTAuthenticator(cfg.secret, cfg.issuer, cfg.issuer), nil
+	}
+
+	signingKey, err := auth.LoadKeyFile(cfg.signingKeyFile, cfg.signingKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := make([]*auth.Key, 0, len(cfg.verificationKeyFiles))
+	for _, path := range cfg.verificationKeyFiles {
+		key, err := auth.LoadKeyFile(path, "")
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return auth.NewAsymmetricAuthenticator(signingKey, verificationKeys, cfg.issuer, cfg.issuer)
+}
+
+// parseTrustedProxies parses the IP addresses and CIDR ranges of the trusted
+// proxies.
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// rateLimitFromEnv reads the limit of a route group from the
+// RATE_LIMIT_<NAME>_REQUESTS and RATE_LIMIT_<NAME>_WINDOW variables.
+func rateLimitFromEnv(name string, requests int, window time.Duration) ratelimiter.Limit {
+	return ratelimiter.Limit{
+		Requests: env.GetInt(fmt.Sprintf("RATE_LIMIT_%s_REQUESTS", name), requests),
+		Window:   env.GetDuration(fmt.Sprintf("RATE_LIMIT_%s_WINDOW", name), window),
+	}
+}
@@ -3,15 +3,20 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
-	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/addvanced/gophersocial/internal/ratelimiter"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/net/context"
 )
 
+// AuthTokenMiddleware authenticates the bearer token, which is either a JWT
+// access token or a personal API key.
 func (app *application) AuthTokenMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -27,6 +32,24 @@ func (app *application) AuthTokenMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
+			if strings.HasPrefix(token, apiKeyPrefix) {
+				key, user, err := app.authenticateAPIKey(r.Context(), token)
+				if err != nil {
+					app.unauthorizedErrorResponse(w, r, err)
+					return
+				}
+
+				if user.IsBanned() {
+					app.forbiddenResponse(w, r, ErrUserBanned)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), apiKeyCtxKey, key)
+				userCtx := context.WithValue(ctx, userCtxKey, user)
+				next.ServeHTTP(w, r.WithContext(userCtx))
+				return
+			}
+
 			jwtToken, err := app.authenticator.ValidateToken(token)
 			if err != nil {
 				app.unauthorizedErrorResponse(w, r, err)
@@ -48,13 +71,34 @@ func (app *application) AuthTokenMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				app.unauthorizedErrorResponse(w, r, errors.New("token does not contain a token ID"))
+				return
+			}
+
 			ctx := r.Context()
+			revoked, err := app.isAccessTokenRevoked(ctx, jti)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			} else if revoked {
+				app.unauthorizedErrorResponse(w, r, errors.New("token has been revoked"))
+				return
+			}
+
 			user, err := app.getUser(ctx, userID)
 			if err != nil {
 				app.unauthorizedErrorResponse(w, r, err)
 				return
 			}
 
+			if user.IsBanned() {
+				app.forbiddenResponse(w, r, ErrUserBanned)
+				return
+			}
+
+			ctx = context.WithValue(ctx, tokenClaimsCtxKey, claims)
 			userCtx := context.WithValue(ctx, userCtxKey, user)
 			next.ServeHTTP(w, r.WithContext(userCtx))
 		})
@@ -80,38 +124,159 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+// checkPostOwnership lets the owner of the post through, and users with the
+// permission to act on any post.
+func (app *application) checkPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
 		user := app.getAuthedUser(ctx)
 		post := app.getPostFromCtx(ctx)
 
-		if post.UserID == user.ID {
+		if post.UserID == user.ID || user.HasPermission(permission) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		allowed, err := app.checkRolePrecedence(ctx, user, requiredRole)
-		if err != nil {
-			app.internalServerError(w, r, err)
+		app.forbiddenResponse(w, r, errors.New("user does not own post"))
+	})
+}
+
+// checkCommentOwnership lets the owner of the comment through, and users with
+// the permission to act on any comment.
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		user := app.getAuthedUser(ctx)
+		comment := app.getCommentFromCtx(ctx)
+
+		if comment.UserID == user.ID || user.HasPermission(permission) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		if !allowed {
-			app.forbiddenResponse(w, r, errors.New("user does not own post"))
-			return
+		app.forbiddenResponse(w, r, errors.New("user does not own comment"))
+	})
+}
+
+// RequirePermissionMiddleware only lets users through whose role has been
+// granted the permission. It must run after AuthTokenMiddleware.
+func (app *application) RequirePermissionMiddleware(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.getAuthedUser(r.Context())
+			if user == nil {
+				app.unauthorizedErrorResponse(w, r, ErrUnauthorized)
+				return
+			}
+
+			if !user.HasPermission(permission) {
+				app.forbiddenResponse(w, r, fmt.Errorf("%w: '%s'", ErrMissingPermission, permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RealIPMiddleware sets the remote address of requests from trusted proxies
+// to the client IP in their X-Forwarded-For or X-Real-IP header. The headers
+// of any other request are ignored, as clients can set them to anything.
+func (app *application) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.isTrustedProxy(clientIP(r)) {
+			if ip := app.forwardedIP(r); ip != "" {
+				r.RemoteAddr = ip
+			}
 		}
 		next.ServeHTTP(w, r)
-
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, requiredRole string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, requiredRole)
+// forwardedIP returns the client IP forwarded by trusted proxies. Proxies
+// append to X-Forwarded-For, so it is the rightmost address that isn't a
+// trusted proxy itself.
+func (app *application) forwardedIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		addrs := strings.Split(xff, ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if _, err := netip.ParseAddr(addr); err != nil {
+				return ""
+			} else if !app.isTrustedProxy(addr) {
+				return addr
+			}
+		}
+	}
+
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
+		if _, err := netip.ParseAddr(xrip); err == nil {
+			return xrip
+		}
+	}
+	return ""
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
-		return false, err
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
+	return false
+}
 
-	return user.Role.Level >= role.Level, nil
+// RateLimitMiddleware counts requests against the limit of a route group. The
+// requests of an authenticated user are counted per user, and all others per
+// IP, which is the client IP set by RealIPMiddleware.
+func (app *application) RateLimitMiddleware(name string, limit ratelimiter.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.config.rateLimit.enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+
+			key := fmt.Sprintf("%s:ip:%s", name, clientIP(r))
+			if user := app.getAuthedUser(ctx); user != nil {
+				key = fmt.Sprintf("%s:user:%d", name, user.ID)
+			}
+
+			result, err := app.rateLimiter.Allow(ctx, key, limit)
+			if err != nil {
+				// Fail open, an unavailable limiter must not take the API down
+				app.logger.Errorw("could not check rate limit", "key", key, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reset := int(math.Ceil(result.Reset.Seconds()))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+
+			if !result.Allowed {
+				app.rateLimitExceededResponse(w, r, result.Reset)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
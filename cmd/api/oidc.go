@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/auth"
+	"github.com/addvanced/gophersocial/internal/env"
+	"github.com/addvanced/gophersocial/internal/mailer"
+	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidOIDCState      = errors.New("sign in request is invalid or expired")
+	ErrEmailNotVerified      = errors.New("the email of the external account is not verified")
+	ErrIdentityAlreadyLinked = errors.New("an account of this provider is already linked to the user")
+)
+
+type OIDCTokenRequest struct {
+	Code  string `json:"code" validate:"required,max=2048"`
+	State string `json:"state" validate:"required,max=128"`
+} //	@name	OIDCTokenRequest
+
+// oidcAuthorizeHandler godoc
+//
+//	@Summary		Starts a sign in with an identity provider
+//	@Description	Redirects to the identity provider, using the authorization code flow with PKCE. The provider redirects back to the configured redirect URL with a code and state, to exchange at /auth/oidc/{provider}/token
+//	@Tags			authentication
+//	@Param			provider	path		string	true	"Identity provider"
+//	@Success		302			{string}	string	"Redirect to the identity provider"
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Router			/auth/oidc/{provider} [get]
+func (app *application) oidcAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider, ok := app.getIdentityProvider(w, r)
+	if !ok {
+		return
+	}
+
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	plainState, hashedState := app.generateToken()
+	authRequest := &store.AuthRequest{
+		Provider:     provider.Name(),
+		Nonce:        uuid.New().String(),
+		CodeVerifier: verifier,
+		ExpireAt:     time.Now().Add(app.config.auth.oidc.authRequestExpiration),
+	}
+
+	if err := app.store.Identities.CreateAuthRequest(ctx, hashedState, authRequest); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, plainState, authRequest.Nonce, challenge)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcTokenHandler godoc
+//
+//	@Summary		Completes a sign in with an identity provider
+//	@Description	Exchanges the code and state from the identity provider for a JWT access token and a refresh token. The external account is linked to the user with its verified email when the provider is trusted with emails, and a new, activated, user is created when there is none. Linking to an existing user emails them
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			provider	path		string						true	"Identity provider"
+//	@Param			payload		body		OIDCTokenRequest			true	"Code and state"
+//	@Success		201			{object}	TokenResponse				"Token Created"
+//	@Success		202			{object}	TwoFactorChallengeResponse	"Two-factor code required"
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		401			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		409			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Router			/auth/oidc/{provider}/token [post]
+func (app *application) oidcTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider, ok := app.getIdentityProvider(w, r)
+	if !ok {
+		return
+	}
+
+	var payload OIDCTokenRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	authRequest, err := app.store.Identities.ConsumeAuthRequest(ctx, payload.State)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, ErrInvalidOIDCState)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if authRequest.Provider != provider.Name() {
+		app.unauthorizedErrorResponse(w, r, ErrInvalidOIDCState)
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, payload.Code, authRequest.CodeVerifier, authRequest.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidIDToken), errors.Is(err, auth.ErrProviderRequest):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.signInWithIdentity(ctx, identity)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			// The linked user has been deactivated
+			app.unauthorizedErrorResponse(w, r, err)
+		case ErrEmailNotVerified:
+			app.forbiddenResponse(w, r, err)
+		case ErrIdentityAlreadyLinked, store.ErrDuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsLocked() {
+		app.unauthorizedErrorResponse(w, r, errors.New("account is locked"))
+		return
+	}
+
+	if user.IsBanned() {
+		app.forbiddenResponse(w, r, ErrUserBanned)
+		return
+	}
+
+	// The provider replaces the password, but not the second factor
+	totp, err := app.store.TwoFactor.Get(ctx, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if totp != nil && totp.Enabled() {
+		challenge, err := app.createLoginChallenge(r, user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.createSession(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.recordAudit(r, user.ID, auditLogin, auditTargetUser, user.ID, nil, map[string]any{"method": "oidc:" + provider.Name()})
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMyIdentitiesHandler godoc
+//
+//	@Summary		Fetches the linked external accounts
+//	@Description	Fetches the identity provider accounts linked to the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	[]Identity
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/identities [get]
+func (app *application) getMyIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	identities, err := app.store.Identities.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, identities); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteMyIdentityHandler godoc
+//
+//	@Summary		Unlinks an external account
+//	@Description	Unlinks the account of the identity provider from the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Param			provider	path		string	true	"Identity provider"
+//	@Success		204			{string}	string	"Account unlinked"
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/identities/{provider} [delete]
+func (app *application) deleteMyIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	provider, err := app.GetStringURLParam(ctx, "provider")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Identities.Delete(ctx, user.ID, provider); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("external identity unlinked", "userID", user.ID, "provider", provider)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signInWithIdentity returns the user linked to the external identity. Unknown
+// identities are linked to the user with the same email, or to a new user,
+// but only when the provider has verified the email. An unactivated user with
+// the email is claimed by the identity, and signed out everywhere. An active
+// user is only linked when the provider is trusted with emails, and is told
+// about it by email.
+func (app *application) signInWithIdentity(ctx context.Context, external *auth.ExternalIdentity) (*store.User, error) {
+	userID, err := app.store.Identities.GetUserID(ctx, external.Provider, external.Subject)
+	switch err {
+	case nil:
+		return app.store.Users.GetByID(ctx, userID)
+	case store.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	if external.Email == "" || !external.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	identity := &store.Identity{
+		Provider: external.Provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+
+	claimed, err := app.store.Identities.LinkByEmail(ctx, identity, external.TrustEmail)
+	switch err {
+	case nil:
+		if claimed {
+			// Whoever registered the email without verifying it loses access
+			if err := app.revokeUserSessions(ctx, identity.UserID); err != nil {
+				return nil, err
+			}
+			app.logger.Warnw("unactivated user claimed by external identity", "userID", identity.UserID, "provider", identity.Provider)
+		}
+		app.deleteUserFromCache(ctx, identity.UserID)
+		app.logger.Infow("external identity linked", "userID", identity.UserID, "provider", identity.Provider)
+
+		user, err := app.store.Users.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			app.notifyIdentityLinked(user, identity.Provider)
+		}
+		return user, nil
+	case store.ErrAlreadyExists:
+		return nil, ErrIdentityAlreadyLinked
+	case store.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	return app.createUserWithIdentity(ctx, external, identity)
+}
+
+// notifyIdentityLinked tells the user that an external identity has been
+// linked to their account, in case they didn't link it themselves. Failures
+// are only logged, as the identity is linked either way.
+func (app *application) notifyIdentityLinked(user *store.User, provider string) {
+	vars := struct {
+		Username string
+		Provider string
+		ResetURL string
+	}{
+		Username: user.Username,
+		Provider: provider,
+		ResetURL: fmt.Sprintf("%s/password/forgot", app.config.frontendURL),
+	}
+
+	receipient := mailer.EmailData{
+		Name:  user.Username,
+		Email: user.Email,
+	}
+
+	response, err := app.mailer.Send(mailer.IdentityLinkedTemplate, receipient, vars, (app.config.env != "production"))
+	if err != nil {
+		app.logger.Errorw("could not send identity linked email", "userID", user.ID, "provider", provider, "error", err)
+		return
+	}
+
+	app.logger.Infow("identity linked email sent", "userID", user.ID, "provider", provider, "email_response_code", response)
+}
+
+// createUserWithIdentity creates a user for a new external identity. Taken
+// usernames get a random suffix. The user gets a random password, which can
+// be replaced through a password reset.
+func (app *application) createUserWithIdentity(ctx context.Context, external *auth.ExternalIdentity, identity *store.Identity) (*store.User, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	user := &store.User{Email: external.Email}
+	if err := user.Password.Set(hex.EncodeToString(random)); err != nil {
+		return nil, err
+	}
+
+	baseUsername := usernameFromIdentity(external)
+	user.Username = baseUsername
+
+	const maxAttempts = 5
+	for attempt := 1; ; attempt++ {
+		err := app.store.Identities.CreateUser(ctx, user, identity)
+		if err == nil {
+			break
+		} else if err != store.ErrDuplicateUsername || attempt == maxAttempts {
+			return nil, err
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		user.Username = fmt.Sprintf("%s-%s", baseUsername, hex.EncodeToString(suffix))
+	}
+
+	app.logger.Infow("user registered with external identity", "userID", user.ID, "provider", identity.Provider)
+	return app.store.Users.GetByID(ctx, user.ID)
+}
+
+// usernameFromIdentity suggests a username from the preferred username or the
+// email of the external identity.
+func usernameFromIdentity(external *auth.ExternalIdentity) string {
+	name := external.Username
+	if name == "" {
+		name, _, _ = strings.Cut(external.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.' {
+			b.WriteRune(c)
+		}
+	}
+
+	username := b.String()
+	if len(username) > 90 {
+		username = username[:90]
+	}
+	if len(username) < 3 {
+		username = "user" + username
+	}
+	return username
+}
+
+func (app *application) getIdentityProvider(w http.ResponseWriter, r *http.Request) (auth.IdentityProvider, bool) {
+	name, err := app.GetStringURLParam(r.Context(), "provider")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	provider, ok := app.identityProviders[strings.ToLower(name)]
+	if !ok {
+		app.notFoundResponse(w, r, auth.ErrUnknownProvider)
+		return nil, false
+	}
+	return provider, true
+}
+
+// oidcProvidersFromEnv reads the providers listed in OIDC_PROVIDERS from the
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL, _SCOPES and
+// _TRUST_EMAIL variables.
+func oidcProvidersFromEnv() []auth.OIDCConfig {
+	names := env.GetStringSlice("OIDC_PROVIDERS", nil)
+
+	providers := make([]auth.OIDCConfig, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		providers = append(providers, auth.OIDCConfig{
+			Name:         name,
+			Issuer:       env.GetString(prefix+"_ISSUER", ""),
+			ClientID:     env.GetString(prefix+"_CLIENT_ID", ""),
+			ClientSecret: env.GetString(prefix+"_CLIENT_SECRET", ""),
+			RedirectURL:  env.GetString(prefix+"_REDIRECT_URL", ""),
+			Scopes:       env.GetStringSlice(prefix+"_SCOPES", nil),
+			TrustEmail:   env.GetBool(prefix+"_TRUST_EMAIL", false),
+		})
+	}
+	return providers
+}
+
+// newIdentityProviders creates the configured providers. The redirect URL
+// defaults to the OIDC callback page of the frontend.
+func newIdentityProviders(cfg *config) (map[string]auth.IdentityProvider, error) {
+	providers := make(map[string]auth.IdentityProvider, len(cfg.auth.oidc.providers))
+	for _, providerCfg := range cfg.auth.oidc.providers {
+		if providerCfg.Issuer == "" || providerCfg.ClientID == "" {
+			return nil, fmt.Errorf("identity provider '%s' needs an issuer and a client ID", providerCfg.Name)
+		}
+
+		if providerCfg.RedirectURL == "" {
+			providerCfg.RedirectURL = fmt.Sprintf("%s/auth/oidc/%s/callback", cfg.frontendURL, providerCfg.Name)
+		}
+		providers[providerCfg.Name] = auth.NewOIDCProvider(providerCfg, nil)
+	}
+	return providers, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/addvanced/gophersocial/internal/auth"
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+// unlinkedIdentityStore knows no identities, and fails the test on any
+// attempt to link one.
+type unlinkedIdentityStore struct {
+	t *testing.T
+}
+
+func (s unlinkedIdentityStore) GetUserID(ctx context.Context, provider string, subject string) (int64, error) {
+	return 0, store.ErrNotFound
+}
+
+func (s unlinkedIdentityStore) GetByUserID(context.Context, int64) ([]store.Identity, error) {
+	return nil, nil
+}
+
+func (s unlinkedIdentityStore) LinkByEmail(context.Context, *store.Identity, bool) (bool, error) {
+	s.t.Error("LinkByEmail called")
+	return false, nil
+}
+
+func (s unlinkedIdentityStore) CreateUser(context.Context, *store.User, *store.Identity) error {
+	s.t.Error("CreateUser called")
+	return nil
+}
+
+func (s unlinkedIdentityStore) Delete(ctx context.Context, userID int64, provider string) error {
+	return nil
+}
+
+func (s unlinkedIdentityStore) CreateAuthRequest(ctx context.Context, stateHash string, req *store.AuthRequest) error {
+	return nil
+}
+
+func (s unlinkedIdentityStore) ConsumeAuthRequest(ctx context.Context, state string) (*store.AuthRequest, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s unlinkedIdentityStore) PurgeExpiredAuthRequests(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestSignInWithIdentityRequiresVerifiedEmail(t *testing.T) {
+	app := &application{}
+	app.store.Identities = unlinkedIdentityStore{t}
+
+	tests := []struct {
+		name     string
+		external auth.ExternalIdentity
+	}{
+		{name: "unverified email", external: auth.ExternalIdentity{Provider: "stub", Subject: "subject-1", Email: "gopher@example.com"}},
+		{name: "no email", external: auth.ExternalIdentity{Provider: "stub", Subject: "subject-1", EmailVerified: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := app.signInWithIdentity(context.Background(), &tt.external); err != ErrEmailNotVerified {
+				t.Errorf("signInWithIdentity() error = %v, want %v", err, ErrEmailNotVerified)
+			}
+		})
+	}
+}
+
+// linkingIdentityStore records whether active users may be linked, and
+// reports that the user with the email is active.
+type linkingIdentityStore struct {
+	unlinkedIdentityStore
+	linkActive *bool
+}
+
+func (s linkingIdentityStore) LinkByEmail(ctx context.Context, identity *store.Identity, linkActive bool) (bool, error) {
+	*s.linkActive = linkActive
+	return false, store.ErrDuplicateEmail
+}
+
+func TestSignInWithIdentityLinksOnlyForTrustedProviders(t *testing.T) {
+	for _, trustEmail := range []bool{false, true} {
+		var linkActive bool
+		app := &application{}
+		app.store.Identities = linkingIdentityStore{unlinkedIdentityStore{t}, &linkActive}
+
+		external := auth.ExternalIdentity{Provider: "stub", Subject: "subject-1", Email: "gopher@example.com", EmailVerified: true, TrustEmail: trustEmail}
+		if _, err := app.signInWithIdentity(context.Background(), &external); err != store.ErrDuplicateEmail {
+			t.Errorf("signInWithIdentity() error = %v, want %v", err, store.ErrDuplicateEmail)
+		}
+		if linkActive != trustEmail {
+			t.Errorf("LinkByEmail() linkActive = %t for TrustEmail %t", linkActive, trustEmail)
+		}
+	}
+}
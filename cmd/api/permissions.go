@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+// Permissions granted to roles in the role_permissions table. Ownership is
+// checked separately, so the :any permissions are only needed to act on the
+// content of other users.
+const (
+	permPostsUpdateAny    = "posts:update:any"
+	permPostsDeleteAny    = "posts:delete:any"
+	permCommentsUpdateAny = "comments:update:any"
+	permCommentsDeleteAny = "comments:delete:any"
+	permUsersUnlock       = "users:unlock"
+	permUsersBan          = "users:ban"
+	permUsersManage       = "users:manage"
+	permRolesManage       = "roles:manage"
+	permAuditRead         = "audit:read"
+	permReportsManage     = "reports:manage"
+)
+
+var (
+	ErrMissingPermission = errors.New("user does not have the required permission")
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleAboveOwn      = errors.New("only roles below your own role can be changed")
+	ErrPermissionNotHeld = errors.New("only permissions you have yourself can be granted")
+)
+
+// getRolesHandler godoc
+//
+//	@Summary		Fetches the roles
+//	@Description	Fetches all roles with their permissions, lowest level first
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	[]Role
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [get]
+func (app *application) getRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.GetAll(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getPermissionsHandler godoc
+//
+//	@Summary		Fetches the permissions
+//	@Description	Fetches all permissions that can be granted to roles
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	[]Permission
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/permissions [get]
+func (app *application) getPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Roles.GetPermissions(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, permissions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// grantPermissionHandler godoc
+//
+//	@Summary		Grants a permission to a role
+//	@Description	Grants a permission to a role below your own. Only permissions you have yourself can be granted. Users of the role are dropped from the cache, so the change applies to their next request
+//	@Tags			admin
+//	@Produce		json
+//	@Param			role		path		string	true	"Role name"
+//	@Param			permission	path		string	true	"Permission name"
+//	@Success		204			{string}	string	"Permission granted"
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{role}/permissions/{permission} [put]
+func (app *application) grantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	role, permission, ok := app.getManagedRolePermission(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.getAuthedUser(ctx).HasPermission(permission) {
+		app.forbiddenResponse(w, r, ErrPermissionNotHeld)
+		return
+	}
+
+	if err := app.store.Roles.AddPermission(ctx, role.ID, permission); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, errors.New("permission not found"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteRoleUsersFromCache(ctx, role)
+	app.audit(r, auditPermissionGranted, auditTargetRole, role.ID, nil, map[string]any{"permission": permission})
+	app.logger.Infow("permission granted", "role", role.Name, "permission", permission, "adminID", app.getAuthedUser(ctx).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokePermissionHandler godoc
+//
+//	@Summary		Revokes a permission from a role
+//	@Description	Revokes a permission from a role below your own. Users of the role are dropped from the cache, so the change applies to their next request
+//	@Tags			admin
+//	@Produce		json
+//	@Param			role		path		string	true	"Role name"
+//	@Param			permission	path		string	true	"Permission name"
+//	@Success		204			{string}	string	"Permission revoked"
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{role}/permissions/{permission} [delete]
+func (app *application) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	role, permission, ok := app.getManagedRolePermission(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Roles.RemovePermission(ctx, role.ID, permission); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, errors.New("role does not have the permission"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteRoleUsersFromCache(ctx, role)
+	app.audit(r, auditPermissionRevoked, auditTargetRole, role.ID, map[string]any{"permission": permission}, nil)
+	app.logger.Infow("permission revoked", "role", role.Name, "permission", permission, "adminID", app.getAuthedUser(ctx).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteRoleUsersFromCache drops the users of the role from the cache, as the
+// cached users embed the permissions of their role. Reading a cached user
+// refreshes its expiry, so active users would otherwise keep stale
+// permissions.
+func (app *application) deleteRoleUsersFromCache(ctx context.Context, role *store.Role) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	ids, err := app.store.Roles.GetUserIDs(ctx, role.ID)
+	if err != nil {
+		app.logger.Errorw("could not get users of role", "role", role.Name, "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Users.DeleteMany(ctx, ids); err != nil {
+		app.logger.Errorw("could not delete users of role from cache", "role", role.Name, "error", err)
+	}
+}
+
+// getManagedRolePermission reads the role and permission of the URL, and
+// checks that the role is below the role of the authenticated user, so users
+// can't raise their own permissions.
+func (app *application) getManagedRolePermission(w http.ResponseWriter, r *http.Request) (*store.Role, string, bool) {
+	ctx := r.Context()
+
+	roleName, err := app.GetStringURLParam(ctx, "role")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, "", false
+	}
+
+	permission, err := app.GetStringURLParam(ctx, "permission")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, "", false
+	}
+
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrRoleNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, "", false
+	}
+
+	if role.Level >= app.getAuthedUser(ctx).Role.Level {
+		app.forbiddenResponse(w, r, ErrRoleAboveOwn)
+		return nil, "", false
+	}
+	return role, permission, true
+}
@@ -13,27 +13,29 @@ import (
 const postCtxKey ctxKey = "post"
 
 type CreatePostRequest struct {
-	Title   string   `json:"title" validate:"required,min=3,max=200"`
-	Content string   `json:"content" validate:"required,min=3,max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string   `json:"title" validate:"required,min=3,max=200"`
+	Content    string   `json:"content" validate:"required,min=3,max=1000"`
+	Tags       []string `json:"tags"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers unlisted private"`
 } //	@name	CreatePostRequest
 
 type UpdatePostRequest struct {
-	Title   *string `json:"title" validate:"omitempty,min=3,max=200"`
-	Content *string `json:"content" validate:"omitempty,min=3,max=1000"`
+	Title      *string `json:"title" validate:"omitempty,min=3,max=200"`
+	Content    *string `json:"content" validate:"omitempty,min=3,max=1000"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers unlisted private"`
 } //	@name	CreatePostRequest
 
 // getPostHandler godoc
 //
 //	@Summary		Fetches a post
-//	@Description	Fetches a post by ID
+//	@Description	Fetches a post by ID, including the first page of its top-level comments and its reactions. Followers posts are only shown to followers of the author, and private posts to the author
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
-//	@Success		200	{object}	Post
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Success		200	{object}	PostWithMetadata
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,15 +47,50 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
 	comments, err := app.getPostComments(ctx, post.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	post.Comments = comments
+	post.Comments, err = app.withoutBlockedComments(ctx, user.ID, comments.Items)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	commentsCount, err := app.store.Comments.CountByPostID(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	reactions, err := app.getReactionCounts(ctx, []int64{post.ID})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	myReaction, err := app.store.Reactions.GetUserReaction(ctx, post.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := store.PostWithMetadata{
+		Post:          *post,
+		CommentsCount: commentsCount,
+		Reactions:     reactions[post.ID],
+		MyReaction:    myReaction,
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -61,15 +98,15 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 // createPostHandler godoc
 //
 //	@Summary		Creates a post
-//	@Description	Creates a post
+//	@Description	Creates a post. Visibility is one of public, followers, unlisted and private, and defaults to public. Unlisted posts can be viewed by anyone with the link, but are left out of feeds
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreatePostRequest	true	"Post request payload"
 //	@Success		201		{object}	Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -93,10 +130,14 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  authUser.ID,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     authUser.ID,
+		Visibility: payload.Visibility,
+	}
+	if post.Visibility == "" {
+		post.Visibility = store.PostVisibilityPublic
 	}
 
 	if err := app.store.Posts.Create(ctx, post); err != nil {
@@ -116,17 +157,17 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // updatePostHandler godoc
 //
 //	@Summary		Updates a post
-//	@Description	Updates a post by ID
+//	@Description	Updates a post by ID, including its visibility
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id		path		int					true	"Post ID"
 //	@Param			payload	body		UpdatePostRequest	true	"Post request payload"
 //	@Success		200		{object}	Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -149,12 +190,16 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before := *post
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
 
 	if err := app.store.Posts.Update(ctx, post); err != nil {
 		switch err {
@@ -172,6 +217,8 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	app.auditOverride(r, auditPostUpdated, auditTargetPost, post.ID, post.UserID, before, post)
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -186,8 +233,8 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		204	{object}	string
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [delete]
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -217,6 +264,9 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		app.logger.Warnw("could not delete comments from cache", "postID", post.ID, "error", err)
 	}
 
+	app.deleteReactionCountsFromCache(ctx, post.ID)
+	app.auditOverride(r, auditPostDeleted, auditTargetPost, post.ID, post.UserID, map[string]any{"user_id": post.UserID, "title": post.Title, "content": post.Content}, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -241,11 +291,62 @@ func (app *application) addPostToCtxMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Posts that can't be viewed don't exist for the user
+		if ok, err := app.canViewPost(ctx, post); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		} else if !ok {
+			app.notFoundResponse(w, r, fmt.Errorf("post with ID '%d' was not found", postID))
+			return
+		}
+
 		postCtx := context.WithValue(ctx, postCtxKey, post)
 		next.ServeHTTP(w, r.WithContext(postCtx))
 	})
 }
 
+// canViewPost reports whether the authenticated user can view the post.
+// Private posts are only shown to their author. Hidden posts are only shown to
+// their author and moderators, who can see them whatever the privacy of the
+// author. Followers posts, and the posts of private users, are shown to the
+// approved followers of the author as well.
+func (app *application) canViewPost(ctx context.Context, post *store.Post) (bool, error) {
+	if user := app.getAuthedUser(ctx); user != nil && user.ID == post.UserID {
+		return true, nil
+	} else if post.Visibility == store.PostVisibilityPrivate {
+		return false, nil
+	}
+
+	if post.HiddenAt != nil {
+		return app.canSeeHidden(ctx, post.UserID), nil
+	}
+
+	if post.Visibility == store.PostVisibilityFollowers {
+		return app.isFollowingAuthor(ctx, post)
+	}
+
+	author, err := app.getUser(ctx, post.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			return false, nil
+		default:
+			return false, err
+		}
+	} else if !author.IsPrivate {
+		return true, nil
+	}
+	return app.isFollowingAuthor(ctx, post)
+}
+
+func (app *application) isFollowingAuthor(ctx context.Context, post *store.Post) (bool, error) {
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		return false, nil
+	}
+	return app.store.Follow.IsFollowing(ctx, user.ID, post.UserID)
+}
+
 func (app *application) getPost(ctx context.Context, id int64) (*store.Post, error) {
 	if !app.config.redis.Enabled() {
 		return app.store.Posts.GetByID(ctx, id)
@@ -277,9 +378,11 @@ func (app *application) getPost(ctx context.Context, id int64) (*store.Post, err
 	return post, nil
 }
 
-func (app *application) getPostComments(ctx context.Context, postID int64) ([]store.Comment, error) {
+// getPostComments returns the first page of top-level comments of a post.
+func (app *application) getPostComments(ctx context.Context, postID int64) (*store.Page[store.Comment], error) {
+	pageable := firstCommentsPage
 	if !app.config.redis.Enabled() {
-		return app.store.Comments.GetByPostID(ctx, postID)
+		return app.store.Comments.GetByPostID(ctx, postID, &pageable)
 	}
 
 	comments, err := app.cacheStorage.Comments.GetByPostID(ctx, postID)
@@ -294,7 +397,7 @@ func (app *application) getPostComments(ctx context.Context, postID int64) ([]st
 	}
 
 	app.logger.Infow("fetching comments from DB", "postID", postID)
-	comments, err = app.store.Comments.GetByPostID(ctx, postID)
+	comments, err = app.store.Comments.GetByPostID(ctx, postID, &pageable)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+var ErrInvalidReactionType = errors.New("invalid reaction type")
+
+// reactToPostHandler godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Reacts to a post with the given reaction type, replacing any previous reaction of the user
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			type	path		string	true	"Reaction type"
+//	@Success		204		{string}	string	"Reaction set"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions/{type} [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	post, user, reactionType, ok := app.getReactionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	previous, err := app.store.Reactions.Set(ctx, post.ID, user.ID, reactionType)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	deltas := map[string]int{reactionType: 1}
+	if previous != nil {
+		deltas[*previous]--
+	}
+	app.updateReactionCountsInCache(ctx, post.ID, deltas)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePostReactionHandler godoc
+//
+//	@Summary		Removes a reaction from a post
+//	@Description	Removes the reaction of the authenticated user from a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			type	path		string	true	"Reaction type"
+//	@Success		204		{string}	string	"Reaction removed"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions/{type} [delete]
+func (app *application) deletePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	post, user, reactionType, ok := app.getReactionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Reactions.Delete(ctx, post.ID, user.ID, reactionType); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, fmt.Errorf("no '%s' reaction on post with ID '%d'", reactionType, post.ID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.updateReactionCountsInCache(ctx, post.ID, map[string]int{reactionType: -1})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getReactionRequest reads the post, the authenticated user and the reaction
+// type of a reaction request, and writes an error response if any is missing.
+func (app *application) getReactionRequest(w http.ResponseWriter, r *http.Request) (*store.Post, *store.User, string, bool) {
+	ctx := r.Context()
+
+	post := app.getPostFromCtx(ctx)
+	if post == nil {
+		app.internalServerError(w, r, errors.New("could not find post"))
+		return nil, nil, "", false
+	}
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return nil, nil, "", false
+	}
+
+	reactionType, err := app.GetStringURLParam(ctx, "type")
+	if err != nil || !slices.Contains(app.config.posts.reactionTypes, reactionType) {
+		app.badRequestResponse(w, r, ErrInvalidReactionType)
+		return nil, nil, "", false
+	}
+
+	return post, user, reactionType, true
+}
+
+// getReactionCounts returns the reaction counts of the given posts, using the
+// cache for posts that have been read recently.
+func (app *application) getReactionCounts(ctx context.Context, postIDs []int64) (map[int64]store.ReactionCounts, error) {
+	if !app.config.redis.Enabled() {
+		return app.store.Reactions.GetCounts(ctx, postIDs)
+	}
+
+	counts, err := app.cacheStorage.Reactions.GetCounts(ctx, postIDs)
+	if err != nil {
+		app.logger.Errorw("could not get reaction counts from cache", "postIDs", postIDs, "error", err)
+		counts = make(map[int64]store.ReactionCounts, len(postIDs))
+	}
+
+	missing := make([]int64, 0)
+	for _, id := range postIDs {
+		if _, ok := counts[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return counts, nil
+	}
+
+	fetched, err := app.store.Reactions.GetCounts(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Reactions.SetCounts(ctx, fetched); err != nil {
+		app.logger.Warnw("could not set reaction counts in cache", "postIDs", missing, "error", err)
+	}
+
+	for id, c := range fetched {
+		counts[id] = c
+	}
+	return counts, nil
+}
+
+// updateReactionCountsInCache adds the deltas to the cached counts of a post.
+// When that fails the counts are dropped, so they are aggregated again rather
+// than drifting.
+func (app *application) updateReactionCountsInCache(ctx context.Context, postID int64, deltas map[string]int) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	if err := app.cacheStorage.Reactions.IncrCounts(ctx, postID, deltas); err != nil {
+		app.logger.Warnw("could not update reaction counts in cache", "postID", postID, "error", err)
+		app.deleteReactionCountsFromCache(ctx, postID)
+	}
+}
+
+func (app *application) deleteReactionCountsFromCache(ctx context.Context, postID int64) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	if err := app.cacheStorage.Reactions.DeleteCounts(ctx, postID); err != nil {
+		app.logger.Warnw("could not delete reaction counts from cache", "postID", postID, "error", err)
+	}
+}
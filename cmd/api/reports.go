@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/addvanced/gophersocial/internal/mailer"
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+var (
+	ErrReportOwnContent = errors.New("you can't report your own content")
+	ErrAlreadyReported  = errors.New("you have already reported this content")
+	ErrReportNotFound   = errors.New("report not found")
+	ErrReportResolved   = errors.New("report has already been resolved")
+)
+
+type CreateReportRequest struct {
+	Reason  string `json:"reason" validate:"required,oneof=spam harassment hate_speech violence sexual_content misinformation other"`
+	Details string `json:"details" validate:"required_if=Reason other,max=1000"`
+} //	@name	CreateReportRequest
+
+type ResolveReportRequest struct {
+	Status string `json:"status" validate:"required,oneof=dismissed actioned"`
+	Note   string `json:"note" validate:"max=1000"`
+} //	@name	ResolveReportRequest
+
+// reportPostHandler godoc
+//
+//	@Summary		Reports a post
+//	@Description	Reports a post to the moderators. The post is hidden once it has reached the report threshold, until a moderator dismisses the reports. Details are required for the reason other
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Post ID"
+//	@Param			payload	body		CreateReportRequest	true	"Report"
+//	@Success		201		{object}	Report
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/report [post]
+func (app *application) reportPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := app.getPostFromCtx(r.Context())
+	if post == nil {
+		app.internalServerError(w, r, errors.New("could not find post"))
+		return
+	}
+
+	app.createReport(w, r, post.UserID, &store.Report{PostID: post.ID})
+}
+
+// reportCommentHandler godoc
+//
+//	@Summary		Reports a comment
+//	@Description	Reports a comment to the moderators. The comment is hidden once it has reached the report threshold, until a moderator dismisses the reports. Details are required for the reason other
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int					true	"Post ID"
+//	@Param			commentID	path		int					true	"Comment ID"
+//	@Param			payload		body		CreateReportRequest	true	"Report"
+//	@Success		201			{object}	Report
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		409			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/comments/{commentID}/report [post]
+func (app *application) reportCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := app.getCommentFromCtx(r.Context())
+	if comment == nil {
+		app.internalServerError(w, r, errors.New("could not find comment"))
+		return
+	}
+
+	app.createReport(w, r, comment.UserID, &store.Report{PostID: comment.PostID, CommentID: &comment.ID})
+}
+
+// createReport files the report of the request on content owned by ownerID.
+func (app *application) createReport(w http.ResponseWriter, r *http.Request, ownerID int64, report *store.Report) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	var payload CreateReportRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if ownerID == user.ID {
+		app.badRequestResponse(w, r, ErrReportOwnContent)
+		return
+	}
+
+	report.ReporterID = user.ID
+	report.Reason = payload.Reason
+	report.Details = payload.Details
+
+	hidden, err := app.store.Reports.Create(ctx, report, app.config.moderation.reportHideThreshold)
+	if err != nil {
+		switch err {
+		case store.ErrAlreadyExists:
+			app.conflictResponse(w, r, ErrAlreadyReported)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, errors.New("reported content not found"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if hidden {
+		app.deleteReportedContentFromCache(ctx, report)
+		app.logger.Infow("reported content hidden", "postID", report.PostID, "commentID", report.CommentID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getReportsHandler godoc
+//
+//	@Summary		Lists reports
+//	@Description	Lists the reports for moderators, oldest first so the queue is worked in order. Status defaults to open, and all lists reports of any status. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status		query		string	false	"One of open, dismissed, actioned and all"
+//	@Param			target_type	query		string	false	"One of post and comment"
+//	@Param			reason		query		string	false	"Reason"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			cursor		query		string	false	"Cursor"
+//	@Param			sort		query		string	false	"Sort"
+//	@Success		200			{object}	PageResponse{data=[]Report}
+//	@Header			200			{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports [get]
+func (app *application) getReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pageable := store.Pageable{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "ASC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filter := new(store.ReportFilter).Parse(r)
+	if err := Validate.StructCtx(ctx, filter); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reports, err := app.store.Reports.Search(ctx, filter, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, reports.Items, newPageMeta(pageable, reports)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getReportHandler godoc
+//
+//	@Summary		Fetches a report
+//	@Description	Fetches a report by ID
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			reportID	path		int	true	"Report ID"
+//	@Success		200			{object}	Report
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID} [get]
+func (app *application) getReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.getReportFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// resolveReportHandler godoc
+//
+//	@Summary		Resolves a report
+//	@Description	Dismisses an open report, or actions it, which hides the reported content. Dismissing the last reports of content that was hidden automatically shows it again. The reporter is notified by email. It needs a session, as API keys are rejected
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int						true	"Report ID"
+//	@Param			payload		body		ResolveReportRequest	true	"Resolution"
+//	@Success		200			{object}	Report
+//	@Failure		400			{object}	ProblemDetails
+//	@Failure		403			{object}	ProblemDetails
+//	@Failure		404			{object}	ProblemDetails
+//	@Failure		409			{object}	ProblemDetails
+//	@Failure		500			{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID} [put]
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ResolveReportRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report, ok := app.getReportFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	moderator := app.getAuthedUser(ctx)
+	before := *report
+
+	report.Status = payload.Status
+	report.ResolvedBy = &moderator.ID
+	if payload.Note != "" {
+		report.ResolutionNote = &payload.Note
+	}
+
+	if err := app.store.Reports.Resolve(ctx, report, app.config.moderation.reportHideThreshold); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponse(w, r, ErrReportResolved)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteReportedContentFromCache(ctx, report)
+	app.audit(r, auditReportResolved, auditTargetReport, report.ID, before, report)
+	app.logger.Infow("report resolved", "reportID", report.ID, "status", report.Status, "moderatorID", moderator.ID)
+
+	app.notifyReporter(ctx, report)
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getReportFromURL(w http.ResponseWriter, r *http.Request) (*store.Report, bool) {
+	ctx := r.Context()
+
+	reportID, err := app.GetInt64URLParam(ctx, "reportID")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	report, err := app.store.Reports.GetByID(ctx, reportID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrReportNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	return report, true
+}
+
+// notifyReporter emails the reporter that their report has been resolved.
+// Failures are logged, as the report is resolved either way.
+func (app *application) notifyReporter(ctx context.Context, report *store.Report) {
+	reporter, err := app.getUser(ctx, report.ReporterID)
+	if err != nil {
+		app.logger.Errorw("could not get reporter", "reportID", report.ID, "userID", report.ReporterID, "error", err)
+		return
+	}
+
+	vars := struct {
+		Username   string
+		TargetType string
+		Actioned   bool
+	}{
+		Username:   reporter.Username,
+		TargetType: report.TargetType(),
+		Actioned:   report.Status == store.ReportStatusActioned,
+	}
+
+	receipient := mailer.EmailData{
+		Name:  reporter.Username,
+		Email: reporter.Email,
+	}
+
+	response, err := app.mailer.Send(mailer.ReportResolvedTemplate, receipient, vars, (app.config.env != "production"))
+	if err != nil {
+		app.logger.Errorw("could not send report resolved email", "reportID", report.ID, "userID", reporter.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("report resolved email sent", "reportID", report.ID, "userID", reporter.ID, "email_response_code", response)
+}
+
+// deleteReportedContentFromCache drops the cached post and first page of
+// comments of reported content, after it has been hidden or shown again.
+func (app *application) deleteReportedContentFromCache(ctx context.Context, report *store.Report) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	if err := app.cacheStorage.Posts.Delete(ctx, report.PostID); err != nil {
+		app.logger.Warnw("could not delete post from cache", "postID", report.PostID, "error", err)
+	}
+
+	if err := app.cacheStorage.Comments.DeleteByPostID(ctx, report.PostID); err != nil {
+		app.logger.Warnw("could not delete comments from cache", "postID", report.PostID, "error", err)
+	}
+}
+
+// canSeeHidden reports whether the authenticated user can see hidden content
+// owned by ownerID, which only its owner and moderators can.
+func (app *application) canSeeHidden(ctx context.Context, ownerID int64) bool {
+	user := app.getAuthedUser(ctx)
+	return user != nil && (user.ID == ownerID || user.HasPermission(permReportsManage))
+}
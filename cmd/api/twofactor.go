@@ -0,0 +1,538 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/auth"
+	"github.com/addvanced/gophersocial/internal/store"
+)
+
+// recoveryCodesCount is the number of recovery codes handed out when
+// two-factor authentication is enabled.
+const recoveryCodesCount = 10
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication has not been set up")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("login challenge is invalid or expired")
+)
+
+type EnrollTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+} //	@name	EnrollTOTPRequest
+
+type VerifyTOTPRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+} //	@name	VerifyTOTPRequest
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+} //	@name	DisableTOTPRequest
+
+type RegenerateRecoveryCodesRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+} //	@name	RegenerateRecoveryCodesRequest
+
+// TwoFactorTokenRequest completes a two-factor login with either a TOTP code
+// or one of the recovery codes.
+type TwoFactorTokenRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+} //	@name	TwoFactorTokenRequest
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+} //	@name	TOTPEnrollmentResponse
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+} //	@name	RecoveryCodesResponse
+
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+	ChallengeType  string `json:"challenge_type"`
+	ExpiresIn      int    `json:"expires_in"`
+} //	@name	TwoFactorChallengeResponse
+
+// enrollTOTPHandler godoc
+//
+//	@Summary		Starts TOTP enrollment
+//	@Description	Generates a TOTP secret for the authenticated user. Two-factor authentication is enabled once a code from it is verified
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		EnrollTOTPRequest	true	"Current password"
+//	@Success		201		{object}	TOTPEnrollmentResponse
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa/totp [post]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload EnrollTOTPRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.TwoFactor.SetSecret(ctx, user.ID, secret); err != nil {
+		switch err {
+		case store.ErrAlreadyExists:
+			app.conflictResponse(w, r, ErrTwoFactorAlreadyEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	response := TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(app.config.auth.totp.issuer, user.Email, secret),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// verifyTOTPHandler godoc
+//
+//	@Summary		Enables TOTP two-factor authentication
+//	@Description	Verifies a code from the enrolled TOTP secret and enables two-factor authentication. The recovery codes are only returned once
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		VerifyTOTPRequest	true	"TOTP code"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa/totp/verify [post]
+func (app *application) verifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user := app.getAuthedUser(ctx)
+	if user == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	var payload VerifyTOTPRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	totp, err := app.store.TwoFactor.Get(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrTwoFactorNotEnrolled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if totp.Enabled() {
+		app.conflictResponse(w, r, ErrTwoFactorAlreadyEnabled)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, ErrInvalidTwoFactorCode)
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.TwoFactor.Enable(ctx, user.ID, step, codes); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.conflictResponse(w, r, ErrTwoFactorAlreadyEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditTwoFactorEnabled, auditTargetUser, user.ID, nil, nil)
+	app.logger.Infow("two-factor authentication enabled", "userID", user.ID)
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// disableTOTPHandler godoc
+//
+//	@Summary		Disables TOTP two-factor authentication
+//	@Description	Disables two-factor authentication, and deletes the TOTP secret and recovery codes
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DisableTOTPRequest	true	"Current password and TOTP code"
+//	@Success		204		{string}	string				"Two-factor authentication disabled"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa/totp [delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload DisableTOTPRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	if ok := app.checkTOTPCode(w, r, user.ID, payload.Code); !ok {
+		return
+	}
+
+	if err := app.store.TwoFactor.Disable(ctx, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrTwoFactorNotEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditTwoFactorDisabled, auditTargetUser, user.ID, nil, nil)
+	app.logger.Infow("two-factor authentication disabled", "userID", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// regenerateRecoveryCodesHandler godoc
+//
+//	@Summary		Regenerates the recovery codes
+//	@Description	Replaces the recovery codes of the authenticated user. The previous codes stop working
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RegenerateRecoveryCodesRequest	true	"Current password and TOTP code"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/2fa/recovery-codes [post]
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload RegenerateRecoveryCodesRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	if ok := app.checkTOTPCode(w, r, user.ID, payload.Code); !ok {
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.TwoFactor.ReplaceRecoveryCodes(ctx, user.ID, codes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createTwoFactorTokenHandler godoc
+//
+//	@Summary		Completes a two-factor login
+//	@Description	Exchanges the challenge token returned by /auth/token, and a TOTP or recovery code, for a JWT access token and a refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TwoFactorTokenRequest	true	"Challenge token and code"
+//	@Success		201		{object}	TokenResponse			"Token Created"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		429		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Router			/auth/token/2fa [post]
+func (app *application) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload TwoFactorTokenRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	challenge, err := app.store.TwoFactor.GetChallenge(ctx, payload.ChallengeToken)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, ErrInvalidChallenge)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Wrong codes count as failed logins, so the code can't be brute-forced
+	// by requesting new challenges with a known password
+	ip := clientIP(r)
+	failures, ok := app.throttleLogin(w, r, user.Email, ip)
+	if !ok {
+		return
+	}
+
+	// A locked account fails without checking the code, so a recovery code
+	// isn't used up by a login that can't succeed
+	err = ErrInvalidTwoFactorCode
+	if !user.IsLocked() {
+		err = app.verifySecondFactor(r, user.ID, payload)
+	}
+
+	if err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.store.TwoFactor.FailChallenge(ctx, payload.ChallengeToken, app.config.auth.totp.maxChallengeAttempts); err != nil && err != store.ErrNotFound {
+			app.logger.Warnw("could not record failed challenge", "userID", user.ID, "error", err)
+		}
+		app.recordLoginFailure(r, user.Email, ip, user, failures)
+		app.unauthorizedErrorResponse(w, r, ErrInvalidTwoFactorCode)
+		return
+	}
+
+	if err := app.store.TwoFactor.DeleteChallenge(ctx, payload.ChallengeToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user.IsBanned() {
+		app.forbiddenResponse(w, r, ErrUserBanned)
+		return
+	}
+
+	if err := app.store.LoginAttempts.ClearFailures(ctx, user.Email); err != nil {
+		app.logger.Warnw("could not clear failed login attempts", "userID", user.ID, "error", err)
+	}
+
+	tokens, err := app.createSession(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.recordAudit(r, user.ID, auditLogin, auditTargetUser, user.ID, nil, map[string]any{"method": "2fa"})
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createLoginChallenge starts a two-factor login for a user whose password has
+// been verified.
+func (app *application) createLoginChallenge(r *http.Request, user *store.User) (*TwoFactorChallengeResponse, error) {
+	plainToken, hashedToken := app.generateToken()
+	expiration := app.config.auth.totp.challengeExpiration
+
+	if err := app.store.TwoFactor.CreateChallenge(r.Context(), user.ID, hashedToken, time.Now().Add(expiration)); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallengeResponse{
+		ChallengeToken: plainToken,
+		ChallengeType:  "totp",
+		ExpiresIn:      int(expiration.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor checks the TOTP code or recovery code of a two-factor
+// login. It returns ErrInvalidTwoFactorCode when the code is wrong.
+func (app *application) verifySecondFactor(r *http.Request, userID int64, payload TwoFactorTokenRequest) error {
+	ctx := r.Context()
+
+	if payload.RecoveryCode != "" {
+		err := app.store.TwoFactor.UseRecoveryCode(ctx, userID, normalizeRecoveryCode(payload.RecoveryCode))
+		if err == store.ErrNotFound {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	totp, err := app.store.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok || !totp.Enabled() {
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err := app.store.TwoFactor.UseStep(ctx, userID, step); err != nil {
+		if err == store.ErrCodeReused {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+// checkTOTPCode verifies a TOTP code of a user with two-factor authentication
+// enabled, and writes the error response if it is wrong.
+func (app *application) checkTOTPCode(w http.ResponseWriter, r *http.Request, userID int64, code string) bool {
+	ctx := r.Context()
+
+	totp, err := app.store.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrTwoFactorNotEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return false
+	}
+
+	if !totp.Enabled() {
+		app.notFoundResponse(w, r, ErrTwoFactorNotEnabled)
+		return false
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, ErrInvalidTwoFactorCode)
+		return false
+	}
+
+	if err := app.store.TwoFactor.UseStep(ctx, userID, step); err != nil {
+		switch err {
+		case store.ErrCodeReused:
+			app.badRequestResponse(w, r, ErrInvalidTwoFactorCode)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+// generateRecoveryCodes returns plain recovery codes like abcde-fghij.
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(random))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
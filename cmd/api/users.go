@@ -3,34 +3,71 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/addvanced/gophersocial/internal/mailer"
 	"github.com/addvanced/gophersocial/internal/store"
 	"github.com/go-redis/redis/v8"
 )
 
 var (
-	ErrUserNotFound          = errors.New("user not found")
-	ErrInvalidUserIDURLParam = errors.New("invalid user ID URL parameter")
-	ErrUserAlreadyFollowed   = errors.New("user already followed")
-	ErrUserAlreadyUnfollowed = errors.New("user already unfollowed")
-	ErrFollowSameUser        = errors.New("cannot follow/unfollow yourself")
+	ErrUserNotFound           = errors.New("user not found")
+	ErrInvalidUserIDURLParam  = errors.New("invalid user ID URL parameter")
+	ErrUserAlreadyFollowed    = errors.New("user already followed")
+	ErrUserAlreadyUnfollowed  = errors.New("user already unfollowed")
+	ErrFollowSameUser         = errors.New("cannot follow/unfollow yourself")
+	ErrFollowAlreadyRequested = errors.New("follow already requested")
+	ErrFollowRequestNotFound  = errors.New("follow request not found")
+	ErrAlreadyFollower        = errors.New("user already follows you")
 )
 
 const userCtxKey ctxKey = "user"
 
+type UpdateUserRequest struct {
+	Username    *string `json:"username" validate:"omitempty,min=3,max=100"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,http_url,max=2048"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Website     *string `json:"website" validate:"omitempty,http_url,max=2048"`
+	IsPrivate   *bool   `json:"is_private"`
+} //	@name	UpdateUserRequest
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+} //	@name	ChangePasswordRequest
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email,max=320"`
+	Password string `json:"password" validate:"required"`
+} //	@name	ChangeEmailRequest
+
+type DeleteUserRequest struct {
+	Password string `json:"password" validate:"required"`
+} //	@name	DeleteUserRequest
+
+// UserProfileResponse is the public profile of a user with its counters
+type UserProfileResponse struct {
+	*store.PublicUser
+	Stats *store.UserStats `json:"stats"`
+} //	@name	UserProfileResponse
+
 // getUserHandler godoc
 //
 //	@Summary		Fetches a user profile
-//	@Description	Fetches a user profile by ID
+//	@Description	Fetches the public profile of a user by ID. The full user is returned when it is the authenticated user
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	User
-//	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Success		200	{object}	UserProfileResponse
+//	@Failure		400	{object}	ProblemDetails
+//	@Failure		403	{object}	ProblemDetails
+//	@Failure		404	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -54,22 +91,348 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if !app.checkNotBlocked(w, r, user.ID) {
+		return
+	}
+
+	var viewerID int64
+	authUser := app.getAuthedUser(ctx)
+	if authUser != nil {
+		viewerID = authUser.ID
+	}
+
+	stats, err := app.store.Users.GetStats(ctx, user.ID, viewerID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Only the user itself gets to see private fields like email and role
+	var profile any = UserProfileResponse{PublicUser: user.Public(), Stats: stats}
+	if authUser != nil && authUser.ID == user.ID {
+		profile = struct {
+			*store.User
+			Stats *store.UserStats `json:"stats"`
+		}{user, stats}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMeHandler godoc
+//
+//	@Summary		Fetches the authenticated user
+//	@Description	Fetches the profile of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	User
+//	@Failure		401	{object}	ProblemDetails
+//	@Failure		500	{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	authUser := app.getAuthedUser(r.Context())
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, authUser); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateMeHandler godoc
+//
+//	@Summary		Updates the authenticated user
+//	@Description	Updates the profile of the authenticated user. Making a private account public approves its pending follow requests
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateUserRequest	true	"User profile"
+//	@Success		200		{object}	User
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	var payload UpdateUserRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := *authUser
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*payload.DisplayName)
+	}
+	if payload.Bio != nil {
+		user.Bio = strings.TrimSpace(*payload.Bio)
+	}
+	if payload.AvatarURL != nil {
+		user.AvatarURL = *payload.AvatarURL
+	}
+	if payload.Location != nil {
+		user.Location = strings.TrimSpace(*payload.Location)
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+
+	if err := app.store.Users.UpdateProfile(ctx, &user); err != nil {
+		switch err {
+		case store.ErrDuplicateUsername:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+
+	// Pending requests are approved once nothing needs approval anymore. The
+	// cached user may be stale, so this doesn't rely on it having been private
+	if payload.IsPrivate != nil && !*payload.IsPrivate {
+		if n, err := app.store.Follow.ApproveAllRequests(ctx, user.ID); err != nil {
+			app.logger.Errorw("could not approve follow requests", "userID", user.ID, "error", err)
+		} else if n > 0 {
+			app.logger.Infow("follow requests approved", "userID", user.ID, "count", n)
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, &user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// changePasswordHandler godoc
+//
+//	@Summary		Changes the password of the authenticated user
+//	@Description	Changes the password of the authenticated user. All sessions are signed out, and a new session is started for the caller
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangePasswordRequest	true	"Current and new password"
+//	@Success		201		{object}	TokenResponse
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/password [put]
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ChangePasswordRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if err := user.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ChangePassword(ctx, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.audit(r, auditPasswordChanged, auditTargetUser, user.ID, nil, nil)
+
+	if err := app.revokeUserSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+
+	tokens, err := app.createSession(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// changeEmailHandler godoc
+//
+//	@Summary		Changes the email of the authenticated user
+//	@Description	Sends a confirmation link to the new email. The email is changed once the link is used
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeEmailRequest	true	"New email and current password"
+//	@Success		202		{string}	string				"Email change requested"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		409		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [put]
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload ChangeEmailRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	// plain token to be used for email...
+	plainToken, hashedToken := app.generateToken()
+	if err := app.store.Users.CreateEmailChange(ctx, user.ID, payload.Email, hashedToken, app.config.mail.inviteExpDuration); err != nil {
+		switch err {
+		case store.ErrDuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{
+		Username:        user.Username,
+		ConfirmationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+	}
+
+	receipient := mailer.EmailData{
+		Name:  user.Username,
+		Email: payload.Email,
+	}
+
+	response, err := app.mailer.Send(mailer.EmailChangeTemplate, receipient, vars, (app.config.env != "production"))
+	if err != nil {
+		app.logger.Errorw("could not send email change confirmation", "error", err, "userID", user.ID)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("email change requested", "userID", user.ID, "email_response_code", response)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// deleteMeHandler godoc
+//
+//	@Summary		Deletes the authenticated user
+//	@Description	Deletes the account of the authenticated user, including posts and comments
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DeleteUserRequest	true	"Current password"
+//	@Success		204		{string}	string				"User deleted"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		401		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (app *application) deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload DeleteUserRequest
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.StructCtx(ctx, payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.getAuthedUserWithPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	// Revoke the access tokens before the sessions are deleted with the user
+	if err := app.revokeUserSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.Delete(ctx, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteUserFromCache(ctx, user.ID)
+
+	app.logger.Infow("user deleted own account", "userID", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // followUserHandler godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user by ID
+//	@Description	Follows a user by ID. Following a private user sends a follow request, which the user has to approve
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{string}	string	"User followed"
-//	@Failure		400	{object}	error	"User payload missing"
-//	@Failure		404	{object}	error	"User not found"
+//	@Success		202	{string}	string	"Follow requested"
+//	@Failure		400	{object}	ProblemDetails	"User payload missing"
+//	@Failure		403	{object}	ProblemDetails	"User blocked"
+//	@Failure		404	{object}	ProblemDetails	"User not found"
+//	@Failure		409	{object}	ProblemDetails	"Follow already requested"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -90,10 +453,17 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := app.store.Follow.Follow(ctx, authUser.ID, userID); err != nil {
+	requested, err := app.store.Follow.Follow(ctx, authUser.ID, userID)
+	if err != nil {
 		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
 		case store.ErrAlreadyExists:
 			app.badRequestResponse(w, r, ErrUserAlreadyFollowed)
+		case store.ErrFollowRequested:
+			app.conflictResponse(w, r, ErrFollowAlreadyRequested)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r, ErrUserBlocked)
 		case store.ErrConflict:
 			app.badRequestResponse(w, r, err)
 		default:
@@ -102,7 +472,12 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
+	status := http.StatusOK
+	if requested {
+		status = http.StatusAccepted
+	}
+
+	if err := app.jsonResponse(w, status, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -110,14 +485,14 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 // unfollowUserHandler gdoc
 //
 //	@Summary		Unfollow a user
-//	@Description	Unfollow a user by ID
+//	@Description	Unfollow a user by ID, or withdraw the request to follow a private user
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{string}	string	"User unfollowed"
-//	@Failure		400	{object}	error	"User payload missing"
-//	@Failure		404	{object}	error	"User not found"
+//	@Failure		400	{object}	ProblemDetails	"User payload missing"
+//	@Failure		404	{object}	ProblemDetails	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -156,13 +531,13 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 // activateUserHandler godoc
 //
 //	@Summary		Activates a new user profile
-//	@Description	Activates a new user profile by the invitation token
+//	@Description	Activates a new user profile, or confirms an email change, by the invitation token
 //	@Tags			users
 //	@Produce		json
 //	@Param			token	path		string	true	"Invitation token"
 //	@Success		202		{string}	string	"User activated"
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
 //	@Router			/users/activate/{token} [put]
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -172,16 +547,21 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := app.store.Users.Activate(ctx, token); err != nil {
+	user, err := app.store.Users.Activate(ctx, token)
+	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundResponse(w, r, errors.New("activation token not found"))
+		case store.ErrDuplicateEmail:
+			app.conflictResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
+	app.deleteUserFromCache(ctx, user.ID)
+
 	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -219,7 +599,163 @@ func (app *application) getUser(ctx context.Context, id int64) (*store.User, err
 	return user, nil
 }
 
+// getAuthedUserWithPassword loads the authenticated user from the DB, as the
+// cached user has no password hash, and checks the password. The error
+// response is written when it returns false.
+func (app *application) getAuthedUserWithPassword(w http.ResponseWriter, r *http.Request, password string) (*store.User, bool) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return nil, false
+	}
+
+	user, err := app.store.Users.GetByID(ctx, authUser.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if err := user.Password.Compare(password); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) deleteUserFromCache(ctx context.Context, id int64) {
+	if !app.config.redis.Enabled() {
+		return
+	}
+
+	if err := app.cacheStorage.Users.Delete(ctx, id); err != nil {
+		app.logger.Warnw("could not delete user from cache", "userID", id, "error", err)
+	}
+}
+
 func (app *application) getAuthedUser(ctx context.Context) *store.User {
 	user, _ := ctx.Value(userCtxKey).(*store.User)
 	return user
 }
+
+// getUserFollowersHandler godoc
+//
+//	@Summary		Fetches the followers of a user
+//	@Description	Fetches the users following a user, newest first. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	PageResponse{data=[]FollowUser}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/followers [get]
+func (app *application) getUserFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Follow.GetFollowers, func(stats *store.UserStats) *int {
+		return &stats.FollowersCount
+	})
+}
+
+// getUserFollowingHandler godoc
+//
+//	@Summary		Fetches the users a user follows
+//	@Description	Fetches the users followed by a user, newest first. Pages are fetched by offset, or by cursor when one of the next_cursor or prev_cursor of a previous page is passed
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	PageResponse{data=[]FollowUser}
+//	@Header			200		{string}	Link	"Links to the first, previous and next pages"
+//	@Failure		400		{object}	ProblemDetails
+//	@Failure		403		{object}	ProblemDetails
+//	@Failure		404		{object}	ProblemDetails
+//	@Failure		500		{object}	ProblemDetails
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/following [get]
+func (app *application) getUserFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListResponse(w, r, app.store.Follow.GetFollowing, func(stats *store.UserStats) *int {
+		return &stats.FollowingCount
+	})
+}
+
+type followListFunc func(ctx context.Context, userID int64, viewerID int64, pageable *store.Pageable) (*store.Page[store.FollowUser], error)
+
+// followListResponse writes a page of a followers or following list. The
+// total is read from the stats of the user with the given func.
+func (app *application) followListResponse(w http.ResponseWriter, r *http.Request, list followListFunc, total func(*store.UserStats) *int) {
+	ctx := r.Context()
+
+	authUser := app.getAuthedUser(ctx)
+	if authUser == nil {
+		app.internalServerError(w, r, ErrUnauthorized)
+		return
+	}
+
+	userID, err := app.GetIDFromURL(ctx)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pageable := store.Pageable{
+		Limit: 20,
+		Sort:  "DESC",
+	}.Parse(r)
+
+	if err := Validate.StructCtx(ctx, pageable); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.getUser(ctx, userID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, ErrUserNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkNotBlocked(w, r, userID) {
+		return
+	}
+
+	users, err := list(ctx, userID, authUser.ID, &pageable)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	meta := newPageMeta(pageable, users)
+	if stats, err := app.store.Users.GetStats(ctx, userID, authUser.ID); err != nil {
+		app.logger.Warnw("could not count follow list", "userID", userID, "error", err)
+	} else {
+		meta.Total = total(stats)
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, users.Items, meta); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_parent_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
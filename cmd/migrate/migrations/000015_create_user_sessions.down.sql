@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_revoked_tokens_expire_at;
+DROP TABLE IF EXISTS revoked_tokens;
+
+DROP INDEX IF EXISTS idx_user_sessions_previous_token;
+DROP INDEX IF EXISTS idx_user_sessions_user_id;
+DROP TABLE IF EXISTS user_sessions;
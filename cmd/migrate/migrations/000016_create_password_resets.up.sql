@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS password_resets (
+    token VARCHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    expire_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE password_resets ADD CONSTRAINT fk_password_resets_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
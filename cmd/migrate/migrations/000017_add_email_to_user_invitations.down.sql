@@ -0,0 +1 @@
+ALTER TABLE user_invitations DROP COLUMN IF EXISTS email;
@@ -0,0 +1,2 @@
+-- Invitations with an email are email changes, waiting for the new email to be verified
+ALTER TABLE user_invitations ADD COLUMN email citext;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url VARCHAR(2048) NOT NULL DEFAULT '',
+    ADD COLUMN location VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN website VARCHAR(2048) NOT NULL DEFAULT '';
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id BIGINT PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    enabled_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_totp ADD CONSTRAINT fk_user_totp_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    code VARCHAR(64) NOT NULL,
+    user_id BIGINT NOT NULL,
+    used_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, code)
+);
+
+ALTER TABLE recovery_codes ADD CONSTRAINT fk_recovery_codes_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS login_challenges (
+    token VARCHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expire_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE login_challenges ADD CONSTRAINT fk_login_challenges_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_login_challenges_expire_at ON login_challenges (expire_at);
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role_id, permission)
+);
+
+ALTER TABLE role_permissions ADD CONSTRAINT fk_role_permissions_role_id FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE;
+ALTER TABLE role_permissions ADD CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission) REFERENCES permissions (name) ON DELETE CASCADE;
+
+INSERT INTO
+    permissions (name, description)
+VALUES
+    ('posts:update:any', 'Update posts of other users'),
+    ('posts:delete:any', 'Delete posts of other users'),
+    ('comments:update:any', 'Update comments of other users'),
+    ('comments:delete:any', 'Delete comments of other users'),
+    ('users:unlock', 'Unlock accounts locked after failed logins'),
+    ('users:ban', 'Ban and unban users'),
+    ('users:manage', 'List users, and change their role and account status'),
+    ('roles:manage', 'Grant and revoke the permissions of roles');
+
+-- The permissions match what the role levels allowed before
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.name
+FROM roles r
+JOIN permissions p ON
+    (p.name IN ('posts:update:any', 'comments:update:any') AND r.level >= 200) OR
+    (p.name IN ('posts:delete:any', 'comments:delete:any', 'users:unlock', 'users:ban', 'users:manage') AND r.level >= 300) OR
+    (p.name = 'roles:manage' AND r.level >= 9999)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN banned_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN banned_until TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN ban_reason TEXT;
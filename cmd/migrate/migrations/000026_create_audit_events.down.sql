@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TRIGGER IF EXISTS trg_audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP TABLE IF EXISTS audit_events;
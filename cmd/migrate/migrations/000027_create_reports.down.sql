@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE name = 'reports:manage';
+DROP TABLE IF EXISTS reports;
+ALTER TABLE comments DROP COLUMN IF EXISTS hidden_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS hidden_at;
@@ -0,0 +1,36 @@
+ALTER TABLE posts ADD COLUMN hidden_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE comments ADD COLUMN hidden_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- A report is about a post, or about a comment when comment_id is set
+CREATE TABLE IF NOT EXISTS reports (
+    id BIGSERIAL PRIMARY KEY,
+    reporter_id BIGINT NOT NULL,
+    post_id BIGINT NOT NULL,
+    comment_id BIGINT,
+    reason VARCHAR(32) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    resolved_by BIGINT,
+    resolution_note TEXT,
+    resolved_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE reports ADD CONSTRAINT fk_reports_reporter_id FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE reports ADD CONSTRAINT fk_reports_post_id FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+ALTER TABLE reports ADD CONSTRAINT fk_reports_comment_id FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE;
+ALTER TABLE reports ADD CONSTRAINT fk_reports_resolved_by FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL;
+
+-- Users can report the same post or comment once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_reporter_post ON reports (reporter_id, post_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_reporter_comment ON reports (reporter_id, comment_id) WHERE comment_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_reports_post_id ON reports (post_id, status);
+CREATE INDEX IF NOT EXISTS idx_reports_comment_id ON reports (comment_id, status);
+
+INSERT INTO permissions (name, description) VALUES ('reports:manage', 'Review reported content and resolve reports');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'reports:manage' FROM roles WHERE level >= 200
+ON CONFLICT DO NOTHING;
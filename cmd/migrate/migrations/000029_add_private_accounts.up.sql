@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT false;
+
+-- Follows of private accounts wait here until the account approves them
+CREATE TABLE IF NOT EXISTS follow_requests (
+    user_id BIGINT NOT NULL,
+    requester_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, requester_id),
+    CHECK (user_id <> requester_id)
+);
+
+ALTER TABLE follow_requests ADD CONSTRAINT fk_follow_requests_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE follow_requests ADD CONSTRAINT fk_follow_requests_requester_id FOREIGN KEY (requester_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_follow_requests_requester_id ON follow_requests (requester_id);
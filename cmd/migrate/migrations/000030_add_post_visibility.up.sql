@@ -0,0 +1,4 @@
+-- Public posts are shown to everyone, followers posts to followers only,
+-- unlisted posts to anyone with the link but not in feeds, and private posts
+-- to their author only
+ALTER TABLE posts ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'followers', 'unlisted', 'private'));
@@ -0,0 +1,12 @@
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS previous_token VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_previous_token ON user_sessions (previous_token);
+
+UPDATE user_sessions s SET previous_token = (
+    SELECT t.token FROM user_session_tokens t
+    WHERE t.session_id = s.id
+    ORDER BY t.created_at DESC
+    LIMIT 1
+);
+
+DROP INDEX IF EXISTS idx_user_session_tokens_session_id;
+DROP TABLE IF EXISTS user_session_tokens;
@@ -0,0 +1,18 @@
+-- Every refresh token rotated away from a session, so reuse of any of them
+-- revokes the session
+CREATE TABLE IF NOT EXISTS user_session_tokens (
+    token VARCHAR(64) PRIMARY KEY,
+    session_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_session_tokens ADD CONSTRAINT fk_user_session_tokens_session_id FOREIGN KEY (session_id) REFERENCES user_sessions (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_user_session_tokens_session_id ON user_session_tokens (session_id);
+
+INSERT INTO user_session_tokens (token, session_id)
+SELECT previous_token, id FROM user_sessions WHERE previous_token IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_user_sessions_previous_token;
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS previous_token;
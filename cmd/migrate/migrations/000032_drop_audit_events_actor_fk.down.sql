@@ -0,0 +1,5 @@
+ALTER TABLE audit_events DISABLE TRIGGER trg_audit_events_append_only;
+UPDATE audit_events SET actor_id = NULL WHERE actor_id IS NOT NULL AND actor_id NOT IN (SELECT id FROM users);
+ALTER TABLE audit_events ENABLE TRIGGER trg_audit_events_append_only;
+
+ALTER TABLE audit_events ADD CONSTRAINT fk_audit_events_actor_id FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- The foreign key nulled actor_id on user deletion, which the append-only
+-- trigger rejects. actor_id is kept as the historical ID of the actor instead.
+ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS fk_audit_events_actor_id;
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AsymmetricAuthenticator signs tokens with a private RS256 or EdDSA key, and
+// marks them with the key ID (kid) of the signing key. Tokens signed by any of
+// the known keys are accepted, so keys can be rotated by adding a new signing
+// key while keeping the previous one for verification until its tokens expire.
+type AsymmetricAuthenticator struct {
+	signingKey *Key
+	keys       map[string]*Key
+	keyOrder   []string
+	aud        string // Audience
+	iss        string // Issuer
+}
+
+func NewAsymmetricAuthenticator(signingKey *Key, verificationKeys []*Key, audience, issuer string) (*AsymmetricAuthenticator, error) {
+	if signingKey == nil {
+		return nil, ErrMissingSigningKey
+	} else if !signingKey.CanSign() {
+		return nil, fmt.Errorf("%w: '%s'", ErrKeyCannotSign, signingKey.ID)
+	}
+
+	a := &AsymmetricAuthenticator{
+		signingKey: signingKey,
+		keys:       make(map[string]*Key),
+		aud:        audience,
+		iss:        issuer,
+	}
+
+	for _, key := range append([]*Key{signingKey}, verificationKeys...) {
+		if _, exists := a.keys[key.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate key ID '%s'", ErrInvalidKey, key.ID)
+		}
+		a.keys[key.ID] = key
+		a.keyOrder = append(a.keyOrder, key.ID)
+	}
+
+	return a, nil
+}
+
+func (a *AsymmetricAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.signingKey.method, claims)
+	token.Header["kid"] = a.signingKey.ID
+	return token.SignedString(a.signingKey.signer)
+}
+
+func (a *AsymmetricAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	jwtKeyFn := func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownKeyID, kid)
+		}
+
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key.public, nil
+	}
+
+	return jwt.Parse(token, jwtKeyFn,
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name, jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+func (a *AsymmetricAuthenticator) KeySet() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(a.keyOrder))}
+	for _, kid := range a.keyOrder {
+		set.Keys = append(set.Keys, a.keys[kid].JWK())
+	}
+	return set
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidKey        = errors.New("invalid key")
+	ErrUnsupportedKey    = errors.New("unsupported key type, only RSA and Ed25519 keys are supported")
+	ErrKeyCannotSign     = errors.New("key has no private part and cannot sign tokens")
+	ErrUnknownKeyID      = errors.New("unknown key ID")
+	ErrMissingSigningKey = errors.New("a signing key is required")
+)
+
+// Key is an asymmetric key identified by its key ID (kid). Keys loaded from a
+// public key can only verify tokens.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	signer crypto.Signer
+	public crypto.PublicKey
+}
+
+// LoadKeyFile loads a PEM encoded key from a file. The key ID is the file name
+// without its extension, unless kid is given.
+func LoadKeyFile(path, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid = strings.TrimSpace(kid); kid == "" {
+		kid = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return ParseKeyPEM(kid, data)
+}
+
+// ParseKeyPEM parses a PEM encoded RSA or Ed25519 key. Both private keys
+// (PKCS #1 and PKCS #8) and public keys (PKIX) are supported.
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found for key '%s'", ErrInvalidKey, kid)
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block '%s' for key '%s'", ErrInvalidKey, block.Type, kid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err.Error())
+	}
+
+	return NewKey(kid, parsed)
+}
+
+// NewKey wraps an RSA or Ed25519 private or public key.
+func NewKey(kid string, key any) (*Key, error) {
+	k := &Key{ID: kid}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.signer, k.public = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.method, k.signer, k.public = jwt.SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = jwt.SigningMethodEdDSA, key
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return k, nil
+}
+
+func (k *Key) CanSign() bool {
+	return k.signer != nil
+}
+
+// JWK returns the public part of the key as a JSON Web Key.
+func (k *Key) JWK() JWK {
+	return newJWK(k)
+}
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrProviderRequest = errors.New("identity provider request failed")
+	ErrInvalidIDToken  = errors.New("invalid ID token")
+)
+
+// keysRefreshInterval limits how often the keys of a provider are fetched
+// again when an ID token is signed by an unknown key.
+const keysRefreshInterval = time.Minute
+
+// IdentityProvider signs users in with an account of an external provider,
+// using the authorization code flow with PKCE.
+type IdentityProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// ExternalIdentity is the account of a user at an identity provider. Subject
+// identifies the account at the provider, and never changes.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Picture       string
+	// TrustEmail tells whether the provider is trusted with the email, so the
+	// identity may be linked to an existing account with it.
+	TrustEmail bool
+}
+
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// TrustEmail allows linking identities of the provider to existing
+	// accounts with the same verified email.
+	TrustEmail bool
+}
+
+// OIDCProvider is a generic OpenID Connect provider. Its endpoints are read
+// from the discovery document of the issuer on first use.
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string    `json:"nonce"`
+	Email             string    `json:"email"`
+	EmailVerified     claimBool `json:"email_verified"`
+	Name              string    `json:"name"`
+	PreferredUsername string    `json:"preferred_username"`
+	Picture           string    `json:"picture"`
+}
+
+// claimBool accepts both booleans and strings, as some providers send
+// email_verified as "true".
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	*b = claimBool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+func NewOIDCProvider(config OIDCConfig, client *http.Client) *OIDCProvider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &OIDCProvider{
+		config: config,
+		client: client,
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code, and returns the identity of the
+// verified ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens oidcTokenResponse
+	if err := p.doJSON(req, &tokens); err != nil && tokens.Error == "" {
+		return nil, err
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrProviderRequest, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrInvalidIDToken)
+	}
+
+	claims, err := p.verifyIDToken(ctx, discovery, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &ExternalIdentity{
+		Provider:      p.config.Name,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: bool(claims.EmailVerified),
+		TrustEmail:    p.config.TrustEmail,
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, idToken string) (*idTokenClaims, error) {
+	keyFn := func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.getKey(ctx, discovery, kid)
+	}
+
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims, keyFn,
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// getKey returns the key of the provider with the key ID. The keys are fetched
+// again when the key is unknown, as the provider might have rotated its keys.
+func (p *OIDCProvider) getKey(ctx context.Context, discovery *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownKeyID, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set JWKSet
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip keys of unsupported types, the token might not use them
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownKeyID, kid)
+}
+
+// findKey looks up a key by its ID. Tokens without a key ID are accepted when
+// the provider only has a single key.
+func (p *OIDCProvider) findKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery oidcDiscovery
+	if err := p.doJSON(req, &discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("%w: issuer '%s' does not match '%s'", ErrProviderRequest, discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrProviderRequest)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// doJSON sends the request and decodes the JSON response into v. The body is
+// decoded for error responses too, and an error is returned along with it.
+func (p *OIDCProvider) doJSON(req *http.Request, v any) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrProviderRequest, err.Error())
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrProviderRequest, err.Error())
+	}
+
+	decodeErr := json.Unmarshal(body, v)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrProviderRequest, req.URL.Host, res.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("%w: %s", ErrProviderRequest, decodeErr.Error())
+	}
+	return nil
+}
+
+// NewPKCE generates a code verifier and its S256 code challenge, as described
+// in RFC 7636.
+func NewPKCE() (verifier string, challenge string, err error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+
+	verifier = base64.RawURLEncoding.EncodeToString(random)
+	hash := sha256.Sum256([]byte(verifier))
+	challenge = base64.RawURLEncoding.EncodeToString(hash[:])
+	return verifier, challenge, nil
+}
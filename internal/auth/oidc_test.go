@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "client-id"
+	testCode     = "auth-code"
+)
+
+// stubOIDCServer is an OpenID Connect provider serving discovery, token and
+// JWKS endpoints. It issues an ID token for the authorization code of the last
+// authorization request, after checking its PKCE code verifier.
+type stubOIDCServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu            sync.Mutex
+	keys          []*Key
+	signingKey    *Key
+	codeChallenge string
+	nonce         string
+	claims        func(claims jwt.MapClaims)
+	jwksRequests  int
+}
+
+func newStubOIDCServer(t *testing.T) *stubOIDCServer {
+	t.Helper()
+
+	s := &stubOIDCServer{t: t}
+	s.signingKey = s.addKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, oidcDiscovery{
+			Issuer:                s.URL,
+			AuthorizationEndpoint: s.URL + "/authorize",
+			TokenEndpoint:         s.URL + "/token",
+			JWKSURI:               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.jwksRequests++
+		set := JWKSet{Keys: make([]JWK, 0, len(s.keys))}
+		for _, key := range s.keys {
+			set.Keys = append(set.Keys, key.JWK())
+		}
+		writeTestJSON(w, http.StatusOK, set)
+	})
+	mux.HandleFunc("/token", s.handleToken)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubOIDCServer) addKey(kid string) *Key {
+	s.t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	key, err := NewKey(kid, private)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return key
+}
+
+// authorize records the PKCE challenge and nonce of the authorization URL,
+// like the authorization endpoint of a provider would.
+func (s *stubOIDCServer) authorize(authURL string) {
+	s.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		s.t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codeChallenge = q.Get("code_challenge")
+	s.nonce = q.Get("nonce")
+}
+
+func (s *stubOIDCServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil || r.Form.Get("code") != testCode {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	hash := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(hash[:]) != s.codeChallenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          s.nonce,
+		"email":          "Gopher@Example.com",
+		"email_verified": true,
+	}
+	if s.claims != nil {
+		s.claims(claims)
+	}
+
+	token := jwt.NewWithClaims(s.signingKey.method, claims)
+	token.Header["kid"] = s.signingKey.ID
+	idToken, err := token.SignedString(s.signingKey.signer)
+	if err != nil {
+		s.t.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]string{"id_token": idToken})
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// signIn runs the authorization code flow against the stub server.
+func signIn(t *testing.T, p *OIDCProvider, s *stubOIDCServer, nonce string) (*ExternalIdentity, error) {
+	t.Helper()
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authorize(authURL)
+
+	return p.Exchange(context.Background(), testCode, verifier, nonce)
+}
+
+func newTestProvider(s *stubOIDCServer) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:        "stub",
+		Issuer:      s.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost/callback",
+	}, s.Client())
+}
+
+func TestOIDCExchange(t *testing.T) {
+	s := newStubOIDCServer(t)
+	p := newTestProvider(s)
+
+	identity, err := signIn(t, p, s, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	want := ExternalIdentity{
+		Provider:      "stub",
+		Subject:       "subject-1",
+		Email:         "gopher@example.com",
+		EmailVerified: true,
+	}
+	if *identity != want {
+		t.Errorf("Exchange() = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeWrongCodeVerifier(t *testing.T) {
+	s := newStubOIDCServer(t)
+	p := newTestProvider(s)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authorize(authURL)
+
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Exchange(context.Background(), testCode, otherVerifier, "nonce-1"); !errors.Is(err, ErrProviderRequest) {
+		t.Errorf("Exchange() error = %v, want %v", err, ErrProviderRequest)
+	}
+}
+
+func TestOIDCExchangeNonceMismatch(t *testing.T) {
+	s := newStubOIDCServer(t)
+	p := newTestProvider(s)
+
+	s.claims = func(claims jwt.MapClaims) {
+		claims["nonce"] = "other-nonce"
+	}
+
+	if _, err := signIn(t, p, s, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() error = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestOIDCExchangeInvalidClaims(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim string
+		value any
+	}{
+		{name: "wrong audience", claim: "aud", value: "other-client"},
+		{name: "wrong issuer", claim: "iss", value: "https://issuer.example.com"},
+		{name: "expired", claim: "exp", value: time.Now().Add(-time.Hour).Unix()},
+		{name: "no subject", claim: "sub", value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubOIDCServer(t)
+			p := newTestProvider(s)
+
+			s.claims = func(claims jwt.MapClaims) {
+				claims[tt.claim] = tt.value
+			}
+
+			if _, err := signIn(t, p, s, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange() error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeEmailNotVerified(t *testing.T) {
+	for _, value := range []any{false, "false"} {
+		s := newStubOIDCServer(t)
+		p := newTestProvider(s)
+
+		s.claims = func(claims jwt.MapClaims) {
+			claims["email_verified"] = value
+		}
+
+		identity, err := signIn(t, p, s, "nonce-1")
+		if err != nil {
+			t.Fatalf("Exchange() error = %v", err)
+		}
+		if identity.EmailVerified {
+			t.Errorf("Exchange() EmailVerified = true for email_verified %#v, want false", value)
+		}
+	}
+}
+
+func TestOIDCExchangeUnknownKeyID(t *testing.T) {
+	s := newStubOIDCServer(t)
+	p := newTestProvider(s)
+
+	if _, err := signIn(t, p, s, "nonce-1"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// The provider rotates to a key the cached key set doesn't have yet. It
+	// isn't fetched again within the refresh interval.
+	s.signingKey = s.addKey("key-2")
+
+	if _, err := signIn(t, p, s, "nonce-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange() error = %v, want %v", err, ErrInvalidIDToken)
+	}
+	if s.jwksRequests != 1 {
+		t.Fatalf("JWKS requests = %d, want 1", s.jwksRequests)
+	}
+
+	p.mu.Lock()
+	p.keysFetchedAt = time.Now().Add(-keysRefreshInterval)
+	p.mu.Unlock()
+
+	if _, err := signIn(t, p, s, "nonce-3"); err != nil {
+		t.Fatalf("Exchange() after refresh interval error = %v", err)
+	}
+	if s.jwksRequests != 2 {
+		t.Errorf("JWKS requests = %d, want 2", s.jwksRequests)
+	}
+}
@@ -41,6 +41,21 @@ func GetDuration(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
+// GetStringSlice returns the comma separated values of the key, ignoring empty
+// values.
+func GetStringSlice(key string, fallback []string) []string {
+	if val, found := lookupEnv(key); found {
+		values := make([]string, 0)
+		for _, v := range strings.Split(val, ",") {
+			if v = cleanString(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return fallback
+}
+
 func lookupEnv(key string) (string, bool) {
 	val := cleanString(os.Getenv(cleanString(key)))
 	return val, len(val) > 0
@@ -9,7 +9,12 @@ import (
 const (
 	maxRetries = 3
 
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	UserWelcomeTemplate    = "user_invitation.tmpl"
+	PasswordResetTemplate  = "password_reset.tmpl"
+	EmailChangeTemplate    = "email_change.tmpl"
+	AccountLockedTemplate  = "account_locked.tmpl"
+	ReportResolvedTemplate = "report_resolved.tmpl"
+	IdentityLinkedTemplate = "identity_linked.tmpl"
 )
 
 //go:embed templates
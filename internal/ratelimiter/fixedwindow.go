@@ -0,0 +1,58 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired windows are removed from memory.
+const sweepInterval = time.Minute
+
+type window struct {
+	count    int
+	expireAt time.Time
+}
+
+// FixedWindowLimiter is an in-memory Limiter. Its counters are local to the
+// process, so it is only accurate when running a single instance.
+type FixedWindowLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func NewFixedWindowLimiter() *FixedWindowLimiter {
+	return &FixedWindowLimiter{
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *FixedWindowLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	w, found := l.windows[key]
+	if !found || !now.Before(w.expireAt) {
+		w = &window{expireAt: now.Add(limit.Window)}
+		l.windows[key] = w
+	}
+	w.count++
+
+	return newResult(w.count, limit, w.expireAt.Sub(now)), nil
+}
+
+func (l *FixedWindowLimiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if !now.Before(w.expireAt) {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,35 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is the number of requests allowed per window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result is the outcome of counting a request against a limit. Reset is the
+// time until the current window ends.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+// Limiter counts requests per key in fixed windows.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+func newResult(count int, limit Limit, reset time.Duration) Result {
+	return Result{
+		Allowed:   count <= limit.Requests,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-count, 0),
+		Reset:     max(reset, 0),
+	}
+}
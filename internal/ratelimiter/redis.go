@@ -0,0 +1,47 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// incrScript increments the counter of a window, and starts the window when
+// the counter has no expiry yet. It returns the count and the milliseconds left
+// of the window.
+var incrScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// RedisLimiter is a Limiter with counters in Redis, shared by all instances.
+type RedisLimiter struct {
+	rdb *redis.Client
+}
+
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := incrScript.Run(ctx, l.rdb, []string{l.getCacheKey(key)}, limit.Window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit response: %v", res)
+	}
+
+	return newResult(int(res[0]), limit, time.Duration(res[1])*time.Millisecond), nil
+}
+
+func (l *RedisLimiter) getCacheKey(key string) string {
+	return fmt.Sprintf("ratelimit-%s", key)
+}
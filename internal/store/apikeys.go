@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// APIKey is a personal API key of a user. Only the hash of the key is stored,
+// and Prefix is the start of the key, to tell keys apart.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpireAt   *time.Time `json:"expire_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+} // @name APIKey
+
+type APIKeyStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey, keyHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expire_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+
+	return s.db.QueryRow(ctx, query,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		keyHash,
+		key.Scopes,
+		key.ExpireAt,
+	).Scan(
+		&key.ID,
+		&key.CreatedAt,
+	)
+}
+
+func (s *APIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, name, prefix, scopes, last_used_at, expire_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.LastUsedAt,
+			&key.ExpireAt,
+			&key.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetByKey returns the unexpired API key of the plain key.
+func (s *APIKeyStore) GetByKey(ctx context.Context, key string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, name, prefix, scopes, last_used_at, expire_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND (expire_at IS NULL OR expire_at > NOW())
+	`
+
+	var apiKey APIKey
+	err := s.db.QueryRow(ctx, query, hashToken(key)).Scan(
+		&apiKey.ID,
+		&apiKey.UserID,
+		&apiKey.Name,
+		&apiKey.Prefix,
+		&apiKey.Scopes,
+		&apiKey.LastUsedAt,
+		&apiKey.ExpireAt,
+		&apiKey.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &apiKey, nil
+}
+
+func (s *APIKeyStore) CountByUserID(ctx context.Context, userID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM api_keys WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+// Touch records the use of the key. It is only written once per interval, so
+// busy keys don't write on every request.
+func (s *APIKeyStore) Touch(ctx context.Context, id int64, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)
+	`
+
+	_, err := s.db.Exec(ctx, query, id, time.Now().Add(-interval))
+	return err
+}
+
+func (s *APIKeyStore) Delete(ctx context.Context, id int64, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// AuditEvent records who did what to which target. Before and After hold the
+// changed fields of the target, when the action changed it. The events are
+// append-only, and only deleted when they are older than the retention. The
+// actor ID is kept when the actor is deleted, so it may not exist anymore.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   *int64          `json:"target_id"`
+	RequestID  string          `json:"request_id"`
+	IP         string          `json:"ip"`
+	Before     json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After      json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	CreatedAt  time.Time       `json:"created_at"`
+} // @name AuditEvent
+
+type AuditStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+func (s *AuditStore) Record(ctx context.Context, event *AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, request_id, ip, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	return s.db.QueryRow(ctx, query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.RequestID,
+		event.IP,
+		event.Before,
+		event.After,
+	).Scan(
+		&event.ID,
+		&event.CreatedAt,
+	)
+}
+
+func (s *AuditStore) Search(ctx context.Context, filter *AuditFilter, pageable *Pageable) (*Page[AuditEvent], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var q Query
+	q.Query(`
+	SELECT a.id, a.actor_id, a.action, a.target_type, a.target_id, a.request_id, a.ip, a.before, a.after, a.created_at
+	FROM audit_events a
+	WHERE 1 = 1`)
+
+	if filter.ActorID > 0 {
+		q.Query(` AND a.actor_id = `)
+		q.Param(filter.ActorID)
+	}
+
+	if filter.Action != "" {
+		q.Query(` AND a.action = `)
+		q.Param(filter.Action)
+	}
+
+	if filter.TargetType != "" {
+		q.Query(` AND a.target_type = `)
+		q.Param(filter.TargetType)
+	}
+
+	if filter.TargetID > 0 {
+		q.Query(` AND a.target_id = `)
+		q.Param(filter.TargetID)
+	}
+
+	if filter.Since != "" {
+		if since, err := time.Parse(timeFormat, filter.Since); err == nil {
+			q.Query(` AND a.created_at >= `)
+			q.Param(pgtype.Timestamptz{Time: since, Valid: true})
+		}
+	}
+
+	if filter.Until != "" {
+		if until, err := time.Parse(timeFormat, filter.Until); err == nil {
+			q.Query(` AND a.created_at <= `)
+			q.Param(pgtype.Timestamptz{Time: until, Valid: true})
+		}
+	}
+
+	reversed, err := keysetQuery(&q, "a.created_at", "a.id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]AuditEvent, 0)
+	for rows.Next() {
+		var event AuditEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.ActorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.RequestID,
+			&event.IP,
+			&event.Before,
+			&event.After,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(events, pageable, reversed, func(e AuditEvent) *Cursor {
+		return NewCursor(e.CreatedAt, e.ID)
+	}), nil
+}
+
+// PurgeBefore deletes the events older than the retention.
+func (s *AuditStore) PurgeBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM audit_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// ErrBlocked is returned when one of two users has blocked the other.
+var ErrBlocked = errors.New("user is blocked")
+
+// BlockStore keeps the users that users have blocked or muted. Blocks work
+// both ways, so blocked users can't follow, comment on the posts of, or view
+// the profile of each other. Mutes only hide the posts of the muted user from
+// the feed of the user that muted them, who is never told about it.
+type BlockStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+// Block blocks the user, and removes the follows and follow requests between
+// the two users. It is a no-op when the user is already blocked.
+func (s *BlockStore) Block(ctx context.Context, blockerID int64, userID int64) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, query, blockerID, userID); err != nil {
+			return relationError(err)
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.Exec(ctx, query, blockerID, userID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+		_, err := tx.Exec(ctx, query, blockerID, userID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID int64, userID int64) error {
+	return s.delete(ctx, `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`, blockerID, userID)
+}
+
+// Mute mutes the user. It is a no-op when the user is already muted.
+func (s *BlockStore) Mute(ctx context.Context, muterID int64, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := s.db.Exec(ctx, query, muterID, userID); err != nil {
+		return relationError(err)
+	}
+	return nil
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterID int64, userID int64) error {
+	return s.delete(ctx, `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`, muterID, userID)
+}
+
+// IsBlocked reports whether either of the two users has blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userID int64, otherID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	var blocked bool
+	if err := s.db.QueryRow(ctx, query, userID, otherID).Scan(&blocked); err != nil {
+		return false, err
+	}
+	return blocked, nil
+}
+
+// GetBlockedIDs returns the IDs of the users that the user has blocked, or
+// that have blocked the user.
+func (s *BlockStore) GetBlockedIDs(ctx context.Context, userID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *BlockStore) delete(ctx context.Context, query string, userID int64, otherID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, query, userID, otherID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// relationError maps a missing user to ErrNotFound, and a user blocking or
+// muting themselves to ErrConflict.
+func relationError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23503":
+			return ErrNotFound
+		case "23514":
+			return ErrConflict
+		}
+	}
+	return err
+}
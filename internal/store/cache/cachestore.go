@@ -72,6 +72,25 @@ func (s *CacheStore[T]) Delete(ctx context.Context, id int64) error {
 	return s.rdb.Del(ctx, ckey).Err()
 }
 
+// deleteBatchSize limits the number of keys deleted by a single command.
+const deleteBatchSize = 1000
+
+func (s *CacheStore[T]) DeleteMany(ctx context.Context, ids []int64) error {
+	keys := make([]string, 0, min(len(ids), deleteBatchSize))
+	for i, id := range ids {
+		ckey, _ := s.getCacheKey(id)
+		keys = append(keys, ckey)
+
+		if len(keys) == deleteBatchSize || i == len(ids)-1 {
+			if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	return nil
+}
+
 func (s *CacheStore[T]) getCacheKey(id int64) (string, error) {
 	cacheType, err := s.getCacheType()
 	return fmt.Sprintf("%s-%d", cacheType, id), err
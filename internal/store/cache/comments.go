@@ -13,9 +13,10 @@ type CommentStore struct {
 	CacheStore[*store.Comment]
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]store.Comment, error) {
+// GetByPostID returns the cached first page of top-level comments of a post.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) (*store.Page[store.Comment], error) {
 
-	comments := make([]store.Comment, 0)
+	comments := &store.Page[store.Comment]{Items: make([]store.Comment, 0)}
 
 	cacheType, err := s.getCacheType()
 	if err != nil {
@@ -30,7 +31,7 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]store.C
 		return comments, fmt.Errorf("%ss for post with ID %d was not found in cache", cacheType, postID)
 	}
 
-	if err := json.Unmarshal([]byte(data), &comments); err != nil {
+	if err := json.Unmarshal([]byte(data), comments); err != nil {
 		return comments, fmt.Errorf("invalid %ss data for post with ID %d", cacheType, postID)
 	}
 
@@ -43,7 +44,7 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]store.C
 	return comments, nil
 }
 
-func (s *CommentStore) SetByPostID(ctx context.Context, postID int64, comments []store.Comment) error {
+func (s *CommentStore) SetByPostID(ctx context.Context, postID int64, comments *store.Page[store.Comment]) error {
 	jsonComments, err := json.Marshal(comments)
 	if err != nil {
 		return err
@@ -58,9 +59,9 @@ func (s *CommentStore) DeleteCommentByIDAndPostID(ctx context.Context, id int64,
 		return err
 	}
 
-	for i, comment := range comments {
+	for i, comment := range comments.Items {
 		if comment.ID == id {
-			comments = append(comments[:i], comments[i+1:]...)
+			comments.Items = append(comments.Items[:i], comments.Items[i+1:]...)
 			break
 		}
 	}
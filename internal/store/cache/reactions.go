@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/addvanced/gophersocial/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// filledField marks a hash of counts filled from the database. A hash without
+// it was only created by increments after the counts expired, so it is
+// incomplete and treated as a cache miss.
+const filledField = "_filled"
+
+// ReactionStore caches the reaction counts of posts in a hash per post, so
+// reading a hot post does not aggregate its reactions every time. Reactions
+// update the cached counts in place.
+type ReactionStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// GetCounts returns the cached counts of the given posts. Posts that are not
+// in the cache are left out of the result.
+func (s *ReactionStore) GetCounts(ctx context.Context, postIDs []int64) (map[int64]store.ReactionCounts, error) {
+	counts := make(map[int64]store.ReactionCounts, len(postIDs))
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(postIDs))
+	for i, id := range postIDs {
+		cmds[i] = pipe.HGetAll(ctx, s.getReactionCountsCacheKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return counts, err
+	}
+
+	for i, cmd := range cmds {
+		fields, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+		if _, ok := fields[filledField]; !ok {
+			continue
+		}
+
+		c := store.ReactionCounts{}
+		for reactionType, value := range fields {
+			if reactionType == filledField {
+				continue
+			}
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				c[reactionType] = n
+			}
+		}
+		counts[postIDs[i]] = c
+	}
+	return counts, nil
+}
+
+// SetCounts replaces the cached counts of the given posts.
+func (s *ReactionStore) SetCounts(ctx context.Context, counts map[int64]store.ReactionCounts) error {
+	pipe := s.rdb.TxPipeline()
+	for postID, c := range counts {
+		key := s.getReactionCountsCacheKey(postID)
+
+		values := make([]any, 0, 2*len(c)+2)
+		values = append(values, filledField, 1)
+		for reactionType, n := range c {
+			values = append(values, reactionType, n)
+		}
+
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, values...)
+		pipe.Expire(ctx, key, s.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IncrCounts adds the given deltas to the cached counts of a post.
+func (s *ReactionStore) IncrCounts(ctx context.Context, postID int64, deltas map[string]int) error {
+	key := s.getReactionCountsCacheKey(postID)
+
+	pipe := s.rdb.TxPipeline()
+	for reactionType, delta := range deltas {
+		pipe.HIncrBy(ctx, key, reactionType, int64(delta))
+	}
+	pipe.Expire(ctx, key, s.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *ReactionStore) DeleteCounts(ctx context.Context, postID int64) error {
+	return s.rdb.Del(ctx, s.getReactionCountsCacheKey(postID)).Err()
+}
+
+func (s *ReactionStore) getReactionCountsCacheKey(postID int64) string {
+	return fmt.Sprintf("post-%d-reactions", postID)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/addvanced/gophersocial/internal/store"
 	"github.com/go-redis/redis/v8"
@@ -10,17 +11,28 @@ import (
 type Storage struct {
 	Users interface {
 		CacheStorer[*store.User]
+		DeleteMany(ctx context.Context, ids []int64) error
 	}
 	Posts interface {
 		CacheStorer[*store.Post]
 	}
 	Comments interface {
 		CacheStorer[*store.Comment]
-		GetByPostID(context.Context, int64) ([]store.Comment, error)
-		SetByPostID(context.Context, int64, []store.Comment) error
+		GetByPostID(context.Context, int64) (*store.Page[store.Comment], error)
+		SetByPostID(context.Context, int64, *store.Page[store.Comment]) error
 		DeleteByPostID(context.Context, int64) error
 		DeleteCommentByIDAndPostID(ctx context.Context, id int64, postID int64) error
 	}
+	Reactions interface {
+		GetCounts(ctx context.Context, postIDs []int64) (map[int64]store.ReactionCounts, error)
+		SetCounts(ctx context.Context, counts map[int64]store.ReactionCounts) error
+		IncrCounts(ctx context.Context, postID int64, deltas map[string]int) error
+		DeleteCounts(ctx context.Context, postID int64) error
+	}
+	Tokens interface {
+		Revoke(ctx context.Context, jti string, expireAt time.Time) error
+		IsRevoked(context.Context, string) (bool, error)
+	}
 }
 
 func NewRedisStorage(cfg *RedisConfig, rdb *redis.Client) Storage {
@@ -39,5 +51,12 @@ func NewRedisStorage(cfg *RedisConfig, rdb *redis.Client) Storage {
 				ttl: cfg.ttl,
 			},
 		},
+		Reactions: &ReactionStore{
+			rdb: rdb,
+			ttl: cfg.postsTTL,
+		},
+		Tokens: &TokenStore{
+			rdb: rdb,
+		},
 	}
 }
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenStore keeps the IDs of revoked access tokens until the tokens expire.
+type TokenStore struct {
+	rdb *redis.Client
+}
+
+func (s *TokenStore) Revoke(ctx context.Context, jti string, expireAt time.Time) error {
+	ttl := time.Until(expireAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.rdb.Set(ctx, s.getRevokedTokenCacheKey(jti), 1, ttl).Err()
+}
+
+func (s *TokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, s.getRevokedTokenCacheKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *TokenStore) getRevokedTokenCacheKey(jti string) string {
+	return fmt.Sprintf("revoked-token-%s", jti)
+}
@@ -11,11 +11,17 @@ import (
 
 type Comment struct {
 	BaseEntity
-	PostID  int64  `json:"post_id"`
-	UserID  int64  `json:"user_id"`
-	Content string `json:"content"`
-	User    User   `json:"user"`
-	Post    Post   `json:"post" swaggerignore:"true"`
+	PostID       int64  `json:"post_id"`
+	ParentID     *int64 `json:"parent_id"`
+	UserID       int64  `json:"user_id"`
+	Content      string `json:"content"`
+	RepliesCount int    `json:"replies_count"`
+	User         User   `json:"user"`
+	Post         Post   `json:"post" swaggerignore:"true"`
+
+	// HiddenAt is set while the comment is hidden after reports. Hidden
+	// comments are left out of comment lists and counts.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
 } // @name Comment
 
 type CommentStore struct {
@@ -28,12 +34,12 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	defer cancel()
 
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3) 
+		INSERT INTO comments (post_id, parent_id, user_id, content)
+		VALUES ($1, $2, $3, $4) 
 		RETURNING id, created_at
 	`
 
-	err := s.db.QueryRow(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(
+	err := s.db.QueryRow(ctx, query, comment.PostID, comment.ParentID, comment.UserID, comment.Content).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
 	)
@@ -43,24 +49,127 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	return nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
-	comments := make([]Comment, 0)
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.id, u.username FROM comments c
+		SELECT 
+			c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, c.hidden_at, u.id, u.username,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.hidden_at IS NULL) AS replies_count
+		FROM comments c
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC
+		WHERE c.id = $1
 	`
-	rows, err := s.db.Query(ctx, query, postID)
+
+	var comment Comment
+	err := s.db.QueryRow(ctx, query, id).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.UserID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.HiddenAt,
+		&comment.User.ID,
+		&comment.User.Username,
+		&comment.RepliesCount,
+	)
 	if err != nil {
 		switch err {
 		case pgx.ErrNoRows:
-			return comments, nil
+			return nil, ErrNotFound
 		default:
 			return nil, err
 		}
 	}
+	return &comment, nil
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE comments SET content = $1 WHERE id = $2`
+
+	res, err := s.db.Exec(ctx, query, comment.Content, comment.ID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM comments WHERE id = $1`
+
+	res, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *CommentStore) CountByPostID(ctx context.Context, postID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1 AND hidden_at IS NULL`
+
+	var count int
+	if err := s.db.QueryRow(ctx, query, postID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetByPostID returns a page of the top-level comments of a post. Replies are
+// fetched per thread with GetReplies.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64, pageable *Pageable) (*Page[Comment], error) {
+	return s.getPage(ctx, "c.post_id", postID, pageable)
+}
+
+// GetReplies returns a page of the direct replies to a comment.
+func (s *CommentStore) GetReplies(ctx context.Context, parentID int64, pageable *Pageable) (*Page[Comment], error) {
+	return s.getPage(ctx, "c.parent_id", parentID, pageable)
+}
+
+func (s *CommentStore) getPage(ctx context.Context, column string, id int64, pageable *Pageable) (*Page[Comment], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	comments := make([]Comment, 0)
+
+	q := Query{}
+	q.Query(`
+		SELECT 
+			c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, u.id, u.username,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.hidden_at IS NULL) AS replies_count
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.hidden_at IS NULL AND `)
+	q.Query(column)
+	q.Query(` = `)
+	q.Param(id)
+	if column == "c.post_id" {
+		q.Query(` AND c.parent_id IS NULL`)
+	}
+
+	reversed, err := keysetQuery(&q, "c.created_at", "c.id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	for rows.Next() {
@@ -70,18 +179,23 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 		if err := rows.Scan(
 			&c.ID,
 			&c.PostID,
+			&c.ParentID,
 			&c.UserID,
 			&c.Content,
 			&c.CreatedAt,
 			&c.User.ID,
 			&c.User.Username,
+			&c.RepliesCount,
 		); err != nil {
 			s.logger.Errorw("Could not add comment", "errors", err.Error())
 			continue
 		}
 		comments = append(comments, c)
 	}
-	return comments, nil
+
+	return newPage(comments, pageable, reversed, func(c Comment) *Cursor {
+		return NewCursor(c.CreatedAt, c.ID)
+	}), nil
 }
 
 func (s *CommentStore) CreateBatch(ctx context.Context, comments []*Comment) error {
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a list ordered by creation time, with the ID as a
+// tiebreaker. It is handed to clients as an opaque string. A cursor with Prev
+// set points to the page before the position instead of the page after it.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+	Prev      bool
+}
+
+func NewCursor(createdAt time.Time, id int64) *Cursor {
+	return &Cursor{CreatedAt: createdAt, ID: id}
+}
+
+func (c *Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	if c.Prev {
+		raw += ":prev"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "prev") {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id := parts[0], parts[1]
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursorID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := NewCursor(time.Unix(0, unixNano).UTC(), cursorID)
+	cursor.Prev = len(parts) == 3
+	return cursor, nil
+}
+
+// Page is a page of a list with keyset pagination. The cursors are empty when
+// there is no page in that direction, and HasMore reports whether there is a
+// next page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// keysetQuery appends the cursor condition, ordering and limit of a page to a
+// query that already has a WHERE clause. Without a cursor the page is fetched
+// by offset. One extra row is fetched, so newPage can tell whether there is
+// more, and pages before a cursor are fetched in reverse order.
+func keysetQuery(q *Query, createdAtColumn string, idColumn string, pageable *Pageable) (reversed bool, err error) {
+	order, cmp := "DESC", "<"
+	if pageable.IsAscending() {
+		order, cmp = "ASC", ">"
+	}
+
+	if pageable.Cursor != "" {
+		cursor, err := DecodeCursor(pageable.Cursor)
+		if err != nil {
+			return false, err
+		}
+
+		if cursor.Prev {
+			reversed = true
+			order, cmp = reverseOrder(order), reverseCmp(cmp)
+		}
+
+		q.Query(fmt.Sprintf(" AND (%s, %s) %s (", createdAtColumn, idColumn, cmp))
+		q.Param(cursor.CreatedAt)
+		q.Query(`, `)
+		q.Param(cursor.ID)
+		q.Query(`)`)
+	}
+
+	q.Query(fmt.Sprintf(" ORDER BY %s %s, %s %s", createdAtColumn, order, idColumn, order))
+	if pageable.Cursor == "" && pageable.Offset > 0 {
+		q.Query(` OFFSET `)
+		q.Param(pageable.Offset)
+	}
+	q.Query(` LIMIT `)
+	q.Param(pageable.Limit + 1)
+
+	return reversed, nil
+}
+
+// newPage turns the rows fetched with keysetQuery into a page, with cursors to
+// the neighbouring pages.
+func newPage[T any](rows []T, pageable *Pageable, reversed bool, cursorOf func(T) *Cursor) *Page[T] {
+	hasMore := len(rows) > pageable.Limit
+	if hasMore {
+		rows = rows[:pageable.Limit]
+	}
+	if reversed {
+		slices.Reverse(rows)
+	}
+
+	page := &Page[T]{Items: rows}
+	if len(rows) == 0 {
+		return page
+	}
+
+	// The page in the direction it was fetched from always exists
+	hasNext, hasPrev := hasMore, pageable.Cursor != "" || pageable.Offset > 0
+	if reversed {
+		hasNext, hasPrev = true, hasMore
+	}
+	page.HasMore = hasNext
+
+	if hasNext {
+		page.NextCursor = cursorOf(rows[len(rows)-1]).Encode()
+	}
+	if hasPrev {
+		prev := cursorOf(rows[0])
+		prev.Prev = true
+		page.PrevCursor = prev.Encode()
+	}
+	return page
+}
+
+func reverseOrder(order string) string {
+	if order == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func reverseCmp(cmp string) string {
+	if cmp == "<" {
+		return ">"
+	}
+	return "<"
+}
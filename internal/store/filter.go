@@ -3,6 +3,7 @@ package store
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -43,3 +44,93 @@ func (f FeedFilter) Parse(r *http.Request) (*FeedFilter, error) {
 
 	return &f, nil
 }
+
+// UserFilter filters the users listed by admins. Status is one of active,
+// inactive, banned and locked.
+type UserFilter struct {
+	Search string `json:"search" validate:"max=100"`
+	Role   string `json:"role" validate:"max=255"`
+	Status string `json:"status" validate:"omitempty,oneof=active inactive banned locked"`
+}
+
+func (f UserFilter) Parse(r *http.Request) *UserFilter {
+	q := r.URL.Query()
+
+	f.Search = strings.TrimSpace(q.Get("search"))
+	f.Role = strings.ToLower(strings.TrimSpace(q.Get("role")))
+	f.Status = strings.ToLower(strings.TrimSpace(q.Get("status")))
+	return &f
+}
+
+// AuditFilter filters the audit log. Since and Until use the same format as
+// the feed filter.
+type AuditFilter struct {
+	ActorID    int64  `json:"actor_id" validate:"gte=0"`
+	Action     string `json:"action" validate:"max=64"`
+	TargetType string `json:"target_type" validate:"max=32"`
+	TargetID   int64  `json:"target_id" validate:"gte=0"`
+	Since      string `json:"since" validate:"omitempty,datetime=2006-01-02T15:04:05"`
+	Until      string `json:"until" validate:"omitempty,datetime=2006-01-02T15:04:05"`
+}
+
+func (f AuditFilter) Parse(r *http.Request) (*AuditFilter, error) {
+	q := r.URL.Query()
+
+	if actorID := strings.TrimSpace(q.Get("actor_id")); actorID != "" {
+		id, err := strconv.ParseInt(actorID, 10, 64)
+		if err != nil {
+			return &f, fmt.Errorf("actor_id must be a number")
+		}
+		f.ActorID = id
+	}
+
+	if targetID := strings.TrimSpace(q.Get("target_id")); targetID != "" {
+		id, err := strconv.ParseInt(targetID, 10, 64)
+		if err != nil {
+			return &f, fmt.Errorf("target_id must be a number")
+		}
+		f.TargetID = id
+	}
+
+	f.Action = strings.TrimSpace(q.Get("action"))
+	f.TargetType = strings.TrimSpace(q.Get("target_type"))
+
+	if since := strings.TrimSpace(q.Get("since")); since != "" {
+		if _, err := time.Parse(timeFormat, since); err != nil {
+			return &f, fmt.Errorf("since must be in format '%s'", timeFormat)
+		}
+		f.Since = since
+	}
+
+	if until := strings.TrimSpace(q.Get("until")); until != "" {
+		if _, err := time.Parse(timeFormat, until); err != nil {
+			return &f, fmt.Errorf("until must be in format '%s'", timeFormat)
+		}
+		f.Until = until
+	}
+
+	return &f, nil
+}
+
+// ReportFilter filters the moderation queue. Status defaults to open, and all
+// lists reports of any status.
+type ReportFilter struct {
+	Status     string `json:"status" validate:"omitempty,oneof=open dismissed actioned"`
+	TargetType string `json:"target_type" validate:"omitempty,oneof=post comment"`
+	Reason     string `json:"reason" validate:"max=32"`
+}
+
+func (f ReportFilter) Parse(r *http.Request) *ReportFilter {
+	q := r.URL.Query()
+
+	f.Status = ReportStatusOpen
+	if status := strings.ToLower(strings.TrimSpace(q.Get("status"))); status == "all" {
+		f.Status = ""
+	} else if status != "" {
+		f.Status = status
+	}
+
+	f.TargetType = strings.ToLower(strings.TrimSpace(q.Get("target_type")))
+	f.Reason = strings.ToLower(strings.TrimSpace(q.Get("reason")))
+	return &f
+}
@@ -17,53 +17,351 @@ type Follower struct {
 	CreatedAt  time.Time `json:"created_at"`
 } // @name Follower
 
+// FollowRequest is a user that has requested to follow a private user.
+type FollowRequest struct {
+	PublicUser
+	RequestedAt time.Time `json:"requested_at"`
+} // @name FollowRequest
+
+// FollowUser is a user in a followers or following list.
+type FollowUser struct {
+	PublicUser
+	FollowedAt     time.Time `json:"followed_at"`
+	IsFollowedByMe bool      `json:"is_followed_by_me"`
+} // @name FollowUser
+
 type FollowerStore struct {
 	db     *pgxpool.Pool
 	logger *zap.SugaredLogger
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerID int64, userID int64) error {
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+// ErrFollowRequested is returned when a follow of a private user has already
+// been requested.
+var ErrFollowRequested = errors.New("follow already requested")
 
-	query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+// Follow follows the user, or requests to follow the user when the account is
+// private, in which case requested is true. It returns ErrBlocked when either
+// of the users has blocked the other.
+func (s *FollowerStore) Follow(ctx context.Context, followerID int64, userID int64) (requested bool, err error) {
+	err = withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			SELECT
+				u.is_private,
+				EXISTS (SELECT 1 FROM followers WHERE user_id = u.id AND follower_id = $2),
+				EXISTS (
+					SELECT 1 FROM user_blocks
+					WHERE (blocker_id = u.id AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = u.id)
+				)
+			FROM users u
+			WHERE u.id = $1 AND u.is_active = true
+		`
+
+		var isPrivate, following, blocked bool
+		if err := tx.QueryRow(ctx, query, userID, followerID).Scan(&isPrivate, &following, &blocked); err != nil {
+			switch err {
+			case pgx.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		switch {
+		case blocked:
+			return ErrBlocked
+		case following:
+			return ErrAlreadyExists
+		}
+
+		query = `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+		if isPrivate {
+			query = `INSERT INTO follow_requests (user_id, requester_id) VALUES ($1, $2)`
+		}
 
-	if _, err := s.db.Exec(ctx, query, userID, followerID); err != nil {
-		var pgError *pgconn.PgError
-		if errors.As(err, &pgError) {
-			switch pgError.Code {
-			case "23505":
-				return ErrAlreadyExists
-			case "23514":
-				return ErrConflict
+		if _, err := tx.Exec(ctx, query, userID, followerID); err != nil {
+			var pgError *pgconn.PgError
+			if errors.As(err, &pgError) {
+				switch {
+				case pgError.Code == "23505" && isPrivate:
+					return ErrFollowRequested
+				case pgError.Code == "23505":
+					return ErrAlreadyExists
+				case pgError.Code == "23514":
+					return ErrConflict
+				}
 			}
-		} else {
 			return err
 		}
+
+		requested = isPrivate
+		return nil
+	})
+	return requested, err
+}
+
+// Unfollow unfollows the user, or withdraws the request to follow the user.
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID int64, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		WITH unfollowed AS (
+			DELETE FROM followers WHERE user_id = $1 AND follower_id = $2 RETURNING 1
+		), withdrawn AS (
+			DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2 RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM unfollowed) + (SELECT COUNT(*) FROM withdrawn)
+	`
+
+	var deleted int
+	if err := s.db.QueryRow(ctx, query, userID, followerID).Scan(&deleted); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrNotFound
 	}
+
 	return nil
 }
 
-func (s *FollowerStore) Unfollow(ctx context.Context, followerID int64, userID int64) error {
+// IsFollowing reports whether the follower is an approved follower of the
+// user.
+func (s *FollowerStore) IsFollowing(ctx context.Context, followerID int64, userID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+
+	var following bool
+	if err := s.db.QueryRow(ctx, query, userID, followerID).Scan(&following); err != nil {
+		return false, err
+	}
+	return following, nil
+}
+
+// GetRequests returns a page of the users that have requested to follow the
+// user, newest first unless sorted ascending.
+func (s *FollowerStore) GetRequests(ctx context.Context, userID int64, pageable *Pageable) (*Page[FollowRequest], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	q := Query{}
+	q.Query(`
+		SELECT
+			u.id, u.username, u.is_private, u.created_at, u.display_name, u.bio, u.avatar_url, u.location, u.website,
+			fr.created_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE u.is_active = true
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = fr.user_id AND b.blocked_id = fr.requester_id)
+					OR (b.blocker_id = fr.requester_id AND b.blocked_id = fr.user_id)
+			)
+			AND fr.user_id = `)
+	q.Param(userID)
+
+	reversed, err := keysetQuery(&q, "fr.created_at", "u.id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]FollowRequest, 0)
+	for rows.Next() {
+		var r FollowRequest
+		if err := rows.Scan(
+			&r.ID,
+			&r.Username,
+			&r.IsPrivate,
+			&r.CreatedAt,
+			&r.DisplayName,
+			&r.Bio,
+			&r.AvatarURL,
+			&r.Location,
+			&r.Website,
+			&r.RequestedAt,
+		); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(requests, pageable, reversed, func(r FollowRequest) *Cursor {
+		return NewCursor(r.RequestedAt, r.ID)
+	}), nil
+}
+
+// ApproveRequest turns the request of the requester into a follow. Requests
+// between users that have blocked each other are dropped instead, and
+// ErrBlocked is returned. Requests of users that already follow are dropped
+// too, and ErrAlreadyExists is returned.
+func (s *FollowerStore) ApproveRequest(ctx context.Context, userID int64, requesterID int64) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+	query := `
+		WITH request AS (
+			DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
+			RETURNING user_id, requester_id
+		), checked AS (
+			SELECT r.user_id, r.requester_id, EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = r.user_id AND b.blocked_id = r.requester_id)
+					OR (b.blocker_id = r.requester_id AND b.blocked_id = r.user_id)
+			) AS blocked
+			FROM request r
+		), approved AS (
+			INSERT INTO followers (user_id, follower_id)
+			SELECT c.user_id, c.requester_id FROM checked c WHERE NOT c.blocked
+			ON CONFLICT DO NOTHING
+			RETURNING 1
+		)
+		SELECT c.blocked, EXISTS (SELECT 1 FROM approved) FROM checked c
+	`
 
-	if res, err := s.db.Exec(ctx, query, userID, followerID); err != nil {
+	var blocked, approved bool
+	if err := s.db.QueryRow(ctx, query, userID, requesterID).Scan(&blocked, &approved); err != nil {
 		switch err {
 		case pgx.ErrNoRows:
 			return ErrNotFound
 		default:
 			return err
 		}
+	}
+
+	switch {
+	case blocked:
+		return ErrBlocked
+	case !approved:
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// ApproveAllRequests turns all pending requests to follow the user into
+// follows, for when the user makes their account public. Requests between
+// users that have blocked each other are dropped instead.
+func (s *FollowerStore) ApproveAllRequests(ctx context.Context, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		WITH approved AS (
+			DELETE FROM follow_requests WHERE user_id = $1
+			RETURNING user_id, requester_id
+		)
+		INSERT INTO followers (user_id, follower_id)
+		SELECT a.user_id, a.requester_id FROM approved a
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = a.user_id AND b.blocked_id = a.requester_id)
+				OR (b.blocker_id = a.requester_id AND b.blocked_id = a.user_id)
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	res, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (s *FollowerStore) RejectRequest(ctx context.Context, userID int64, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userID, requesterID)
+	if err != nil {
+		return err
 	} else if res.RowsAffected() == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
 
+// GetFollowers returns a page of the users following the user, newest first
+// unless sorted ascending.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID int64, viewerID int64, pageable *Pageable) (*Page[FollowUser], error) {
+	return s.getFollowPage(ctx, "f.user_id", "f.follower_id", userID, viewerID, pageable)
+}
+
+// GetFollowing returns a page of the users the user follows. See GetFollowers.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID int64, viewerID int64, pageable *Pageable) (*Page[FollowUser], error) {
+	return s.getFollowPage(ctx, "f.follower_id", "f.user_id", userID, viewerID, pageable)
+}
+
+func (s *FollowerStore) getFollowPage(ctx context.Context, userColumn string, listColumn string, userID int64, viewerID int64, pageable *Pageable) (*Page[FollowUser], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	q := Query{}
+	q.Query(`
+		SELECT 
+			u.id, u.username, u.is_private, u.created_at, u.display_name, u.bio, u.avatar_url, u.location, u.website,
+			f.created_at,
+			EXISTS (SELECT 1 FROM followers mf WHERE mf.user_id = u.id AND mf.follower_id = `)
+	q.Param(viewerID)
+	q.Query(`) AS is_followed_by_me
+		FROM followers f
+		JOIN users u ON u.id = `)
+	q.Query(listColumn)
+	q.Query(` WHERE u.is_active = true AND `)
+	q.Query(userColumn)
+	q.Query(` = `)
+	q.Param(userID)
+
+	reversed, err := keysetQuery(&q, "f.created_at", "u.id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]FollowUser, 0)
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(
+			&u.ID,
+			&u.Username,
+			&u.IsPrivate,
+			&u.CreatedAt,
+			&u.DisplayName,
+			&u.Bio,
+			&u.AvatarURL,
+			&u.Location,
+			&u.Website,
+			&u.FollowedAt,
+			&u.IsFollowedByMe,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(users, pageable, reversed, func(u FollowUser) *Cursor {
+		return NewCursor(u.FollowedAt, u.ID)
+	}), nil
+}
+
 func (s *FollowerStore) CreateBatch(ctx context.Context, followers []*Follower) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*3)
 	defer cancel()
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// Identity links a user to an account at an external identity provider.
+type Identity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+} // @name Identity
+
+// AuthRequest is a pending sign in with an identity provider, identified by
+// its state.
+type AuthRequest struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpireAt     time.Time
+}
+
+type IdentityStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+// GetUserID returns the ID of the user linked to the provider account, and
+// records the login.
+func (s *IdentityStore) GetUserID(ctx context.Context, provider string, subject string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE user_identities SET last_login_at = NOW()
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id
+	`
+
+	var userID int64
+	if err := s.db.QueryRow(ctx, query, provider, subject).Scan(&userID); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+func (s *IdentityStore) GetByUserID(ctx context.Context, userID int64) ([]Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), last_login_at, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]Identity, 0)
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.LastLoginAt,
+			&identity.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// LinkByEmail links the identity to the user with the, verified, email of the
+// identity. Users that never activated their account have not proven that they
+// own the email, so anyone could have registered it. They are claimed by the
+// identity instead: the password is replaced by an unusable one, pending
+// invitations, email changes and password resets are dropped, and the user is
+// activated. Active users are only linked when linkActive is set, otherwise
+// ErrDuplicateEmail is returned. It returns whether the user was claimed, so
+// its sessions can be revoked.
+func (s *IdentityStore) LinkByEmail(ctx context.Context, identity *Identity, linkActive bool) (bool, error) {
+	var unusable password
+	if err := unusable.SetRandom(); err != nil {
+		return false, err
+	}
+
+	var claimed bool
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var isActive bool
+		query := `SELECT id, is_active FROM users WHERE email = $1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, identity.Email).Scan(&identity.UserID, &isActive); err != nil {
+			switch err {
+			case pgx.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if isActive && !linkActive {
+			return ErrDuplicateEmail
+		}
+
+		if !isActive {
+			claimed = true
+
+			query = `UPDATE users SET is_active = true, password = $1, updated_at = NOW() WHERE id = $2`
+			if _, err := tx.Exec(ctx, query, unusable.hash, identity.UserID); err != nil {
+				return err
+			}
+
+			for _, query := range []string{
+				`DELETE FROM user_invitations WHERE user_id = $1`,
+				`DELETE FROM password_resets WHERE user_id = $1`,
+			} {
+				if _, err := tx.Exec(ctx, query, identity.UserID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return s.create(ctx, tx, identity)
+	})
+	return claimed, err
+}
+
+// CreateUser creates an active user signed in with the identity, and links
+// them.
+func (s *IdentityStore) CreateUser(ctx context.Context, user *User, identity *Identity) error {
+	users := &UserStore{s.db, s.logger}
+
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		if err := users.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.Exec(ctx, `UPDATE users SET is_active = true WHERE id = $1`, user.ID); err != nil {
+			return err
+		}
+		user.IsActive = true
+
+		identity.UserID = user.ID
+		return s.create(ctx, tx, identity)
+	})
+}
+
+func (s *IdentityStore) create(ctx context.Context, tx pgx.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		RETURNING id, last_login_at, created_at
+	`
+
+	err := tx.QueryRow(ctx, query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.LastLoginAt,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *IdentityStore) Delete(ctx context.Context, userID int64, provider string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *IdentityStore) CreateAuthRequest(ctx context.Context, stateHash string, req *AuthRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO oidc_auth_requests (state, provider, nonce, code_verifier, expire_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := s.db.Exec(ctx, query, stateHash, req.Provider, req.Nonce, req.CodeVerifier, req.ExpireAt)
+	return err
+}
+
+// ConsumeAuthRequest returns and deletes the pending sign in of the plain
+// state, so it can only be completed once.
+func (s *IdentityStore) ConsumeAuthRequest(ctx context.Context, state string) (*AuthRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		DELETE FROM oidc_auth_requests
+		WHERE state = $1
+		RETURNING provider, nonce, code_verifier, expire_at
+	`
+
+	var req AuthRequest
+	err := s.db.QueryRow(ctx, query, hashToken(state)).Scan(
+		&req.Provider,
+		&req.Nonce,
+		&req.CodeVerifier,
+		&req.ExpireAt,
+	)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if req.ExpireAt.Before(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &req, nil
+}
+
+func (s *IdentityStore) PurgeExpiredAuthRequests(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM oidc_auth_requests WHERE expire_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// LoginFailures are the failed login attempts for an account and from an IP
+// within a window.
+type LoginFailures struct {
+	Account int
+	IP      int
+}
+
+type LoginAttemptStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+// RecordFailure records a failed login attempt. The email is recorded even if
+// no user has it, so guessing at unknown accounts is tracked as well.
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, email string, ip string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `INSERT INTO login_attempts (email, ip) VALUES ($1, $2)`
+
+	if _, err := s.db.Exec(ctx, query, normalizeEmail(email), ip); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *LoginAttemptStore) CountFailures(ctx context.Context, email string, ip string, since time.Time) (*LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT 
+			COUNT(*) FILTER (WHERE email = $1),
+			COUNT(*) FILTER (WHERE ip = $2)
+		FROM login_attempts
+		WHERE (email = $1 OR ip = $2) AND created_at > $3
+	`
+
+	var failures LoginFailures
+	if err := s.db.QueryRow(ctx, query, normalizeEmail(email), ip, since).Scan(&failures.Account, &failures.IP); err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// ClearFailures forgets the failed login attempts for an account, after a
+// successful login or when an admin unlocks it.
+func (s *LoginAttemptStore) ClearFailures(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM login_attempts WHERE email = $1`
+
+	if _, err := s.db.Exec(ctx, query, normalizeEmail(email)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeBefore deletes the failed login attempts older than the given time.
+func (s *LoginAttemptStore) PurgeBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM login_attempts WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.TrimSpace(strings.ToLower(email))
+}
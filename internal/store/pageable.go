@@ -10,6 +10,9 @@ type Pageable struct {
 	Limit  int    `json:"limit" validate:"gte=1,lte=20"`
 	Offset int    `json:"offset" validate:"gte=0"`
 	Sort   string `json:"sort" validate:"oneof=asc desc ASC DESC"`
+
+	// Cursor is used instead of Offset by lists with keyset pagination
+	Cursor string `json:"cursor"`
 }
 
 func (p Pageable) Parse(r *http.Request) Pageable {
@@ -31,5 +34,14 @@ func (p Pageable) Parse(r *http.Request) Pageable {
 		p.Sort = sort
 	}
 
+	if cursor := strings.TrimSpace(q.Get("cursor")); cursor != "" {
+		p.Cursor = cursor
+	}
+
 	return p
 }
+
+// IsAscending reports whether the page is sorted in ascending order.
+func (p Pageable) IsAscending() bool {
+	return strings.ToUpper(strings.TrimSpace(p.Sort)) == "ASC"
+}
@@ -13,21 +13,35 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	PostVisibilityPublic    = "public"
+	PostVisibilityFollowers = "followers"
+	PostVisibilityUnlisted  = "unlisted"
+	PostVisibilityPrivate   = "private"
+)
+
 type Post struct {
 	BaseEntity
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Tags      []string  `json:"tags"`
-	UserID    int64     `json:"user_id"`
-	User      User      `json:"user"`
-	Comments  []Comment `json:"comments"`
-	Version   int       `json:"version"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Tags       []string  `json:"tags"`
+	UserID     int64     `json:"user_id"`
+	User       User      `json:"user"`
+	Comments   []Comment `json:"comments"`
+	Version    int       `json:"version"`
+	Visibility string    `json:"visibility"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// HiddenAt is set while the post is hidden after reports. Hidden posts
+	// are only shown to their author and moderators.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
 } // @name Post
 
 type PostWithMetadata struct {
 	Post
-	CommentsCount int `json:"comments_count"`
+	CommentsCount int            `json:"comments_count"`
+	Reactions     ReactionCounts `json:"reactions"`
+	MyReaction    *string        `json:"my_reaction"`
 } // @name PostWithMetadata
 
 type PostStore struct {
@@ -35,7 +49,14 @@ type PostStore struct {
 	logger *zap.SugaredLogger
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pageable, filter *FeedFilter) ([]PostWithMetadata, error) {
+// GetUserFeed returns a page of the feed of a user, without the posts of users
+// that the user has muted or blocked, or that have blocked the user, and of
+// private users the user isn't an approved follower of. Only the user's own
+// posts are shown regardless of their visibility; unlisted and private posts of
+// others are left out, and followers posts of users the user doesn't follow.
+// The page is fetched by cursor when the pageable has one, and by offset
+// otherwise.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pageable, filter *FeedFilter) (*Page[PostWithMetadata], error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
@@ -47,10 +68,12 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pag
 		p.content, 
 		p.tags, 
 		p.version, 
+		p.visibility, 
 		p.created_at, 
 		p.updated_at, 
 		u.username, 
-		COALESCE(c.comments_count, 0) AS comments_count
+		COALESCE(c.comments_count, 0) AS comments_count,
+		mr.type AS my_reaction
 	FROM posts p
 	LEFT JOIN (
 		SELECT 
@@ -64,12 +87,32 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pag
 		SELECT 
 			post_id, COUNT(*) AS comments_count
 		FROM comments
+		WHERE hidden_at IS NULL
 		GROUP BY post_id
 	) c ON c.post_id = p.id
 	LEFT JOIN users u ON p.user_id = u.id
+	LEFT JOIN post_reactions mr ON mr.post_id = p.id AND mr.user_id = `)
+	q.Param(userID)
+	q.Query(`
 	WHERE (p.user_id = `)
 	q.Param(userID)
-	q.Query(` OR f.follower_id IS NOT NULL)`)
+	q.Query(` OR f.follower_id IS NOT NULL) AND p.hidden_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muted_id = p.user_id AND m.muter_id = `)
+	q.Param(userID)
+	q.Query(`)
+	AND NOT EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = p.user_id AND b.blocked_id = `)
+	q.Param(userID)
+	q.Query(`) OR (b.blocked_id = p.user_id AND b.blocker_id = `)
+	q.Param(userID)
+	q.Query(`))
+	AND (p.user_id = `)
+	q.Param(userID)
+	q.Query(` OR (p.visibility = 'public' AND u.is_private = false)
+		OR (p.visibility IN ('public', 'followers') AND EXISTS (SELECT 1 FROM followers pf WHERE pf.user_id = p.user_id AND pf.follower_id = `)
+	q.Param(userID)
+	q.Query(`)))`)
 
 	if sinceStr := strings.TrimSpace(filter.Since); sinceStr != "" {
 		if since, err := time.Parse(time.RFC3339, fmt.Sprintf("%s+02:00", sinceStr)); err == nil {
@@ -106,11 +149,10 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pag
 		q.Query(`)`)
 	}
 
-	q.Query(fmt.Sprintf(" ORDER BY p.created_at %s", strings.TrimSpace(strings.ToUpper(pageable.Sort))))
-	q.Query(` OFFSET `)
-	q.Param(pageable.Offset)
-	q.Query(` LIMIT `)
-	q.Param(pageable.Limit)
+	reversed, err := keysetQuery(&q, "p.created_at", "p.id", pageable)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
 	if err != nil {
@@ -118,7 +160,7 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pag
 	}
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed := make([]PostWithMetadata, 0)
 	for rows.Next() {
 		var p PostWithMetadata
 		if err := rows.Scan(
@@ -128,17 +170,24 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pageable *Pag
 			&p.Content,
 			&p.Tags,
 			&p.Version,
+			&p.Visibility,
 			&p.CreatedAt,
 			&p.UpdatedAt,
 			&p.User.Username,
 			&p.CommentsCount,
+			&p.MyReaction,
 		); err != nil {
 			return nil, err
 		}
 		feed = append(feed, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return feed, nil
+	return newPage(feed, pageable, reversed, func(p PostWithMetadata) *Cursor {
+		return NewCursor(p.CreatedAt, p.ID)
+	}), nil
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
@@ -146,14 +195,15 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	defer cancel()
 
 	query := `
-		INSERT INTO posts (title, content, tags, user_id)
-		VALUES ($1, $2, $3, $4) 
-		RETURNING id, version, created_at, updated_at
+		INSERT INTO posts (title, content, tags, user_id, visibility)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'public')) 
+		RETURNING id, version, visibility, created_at, updated_at
 	`
 
-	err := s.db.QueryRow(ctx, query, post.Title, post.Content, post.Tags, post.UserID).Scan(
+	err := s.db.QueryRow(ctx, query, post.Title, post.Content, post.Tags, post.UserID, post.Visibility).Scan(
 		&post.ID,
 		&post.Version,
+		&post.Visibility,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 	)
@@ -168,7 +218,7 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	defer cancel()
 
 	query := `
-		SELECT id, title, content, tags, user_id, version, created_at, updated_at 
+		SELECT id, title, content, tags, user_id, version, visibility, created_at, updated_at, hidden_at
 		FROM posts 
 		WHERE id = $1
 	`
@@ -181,8 +231,10 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.Tags,
 		&post.UserID,
 		&post.Version,
+		&post.Visibility,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.HiddenAt,
 	)
 	if err != nil {
 		switch err {
@@ -201,12 +253,12 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 
 	query := `
 		UPDATE posts 
-		SET title = $1, content = $2, version = version + 1 
-		WHERE id = $3 AND version = $4 
+		SET title = $1, content = $2, visibility = COALESCE(NULLIF($3, ''), visibility), version = version + 1 
+		WHERE id = $4 AND version = $5 
 		RETURNING version
 	`
 
-	if err := s.db.QueryRow(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version); err != nil {
+	if err := s.db.QueryRow(ctx, query, post.Title, post.Content, post.Visibility, post.ID, post.Version).Scan(&post.Version); err != nil {
 		switch err {
 		case pgx.ErrNoRows:
 			return ErrDirtyRecord
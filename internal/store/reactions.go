@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// ReactionCounts maps a reaction type to the number of users that reacted
+// with it.
+type ReactionCounts map[string]int
+
+type ReactionStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+// Set reacts to a post on behalf of a user. A user has a single reaction per
+// post, so any previous reaction is replaced, and returned so counts can be
+// updated. It is nil when the user had not reacted.
+func (s *ReactionStore) Set(ctx context.Context, postID int64, userID int64, reactionType string) (*string, error) {
+	var previous *string
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `SELECT type FROM post_reactions WHERE post_id = $1 AND user_id = $2 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, postID, userID).Scan(&previous); err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+
+		query = `
+			INSERT INTO post_reactions (post_id, user_id, type)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (post_id, user_id) DO UPDATE SET type = EXCLUDED.type, created_at = NOW()
+		`
+
+		_, err := tx.Exec(ctx, query, postID, userID, reactionType)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+func (s *ReactionStore) Delete(ctx context.Context, postID int64, userID int64, reactionType string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND type = $3`
+
+	res, err := s.db.Exec(ctx, query, postID, userID, reactionType)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetCounts returns the reaction counts of the given posts. Posts without
+// reactions are included with empty counts.
+func (s *ReactionStore) GetCounts(ctx context.Context, postIDs []int64) (map[int64]ReactionCounts, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	counts := make(map[int64]ReactionCounts, len(postIDs))
+	for _, id := range postIDs {
+		counts[id] = ReactionCounts{}
+	}
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	query := `
+		SELECT post_id, type, COUNT(*)
+		FROM post_reactions
+		WHERE post_id = ANY($1)
+		GROUP BY post_id, type
+	`
+
+	rows, err := s.db.Query(ctx, query, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID       int64
+			reactionType string
+			count        int
+		)
+		if err := rows.Scan(&postID, &reactionType, &count); err != nil {
+			return nil, err
+		}
+		counts[postID][reactionType] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetUserReaction returns the reaction of a user to a post, or nil when the
+// user has not reacted.
+func (s *ReactionStore) GetUserReaction(ctx context.Context, postID int64, userID int64) (*string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT type FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+
+	rows, err := s.db.Query(ctx, query, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var reactionType string
+	if err := rows.Scan(&reactionType); err != nil {
+		return nil, err
+	}
+	return &reactionType, nil
+}
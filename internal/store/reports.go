@@ -0,0 +1,266 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned  = "actioned"
+)
+
+// Report flags a post, or a comment when CommentID is set, for moderators to
+// review. Reports are resolved by dismissing them, or by actioning them, which
+// hides the content.
+type Report struct {
+	ID             int64      `json:"id"`
+	ReporterID     int64      `json:"reporter_id"`
+	PostID         int64      `json:"post_id"`
+	CommentID      *int64     `json:"comment_id"`
+	Reason         string     `json:"reason"`
+	Details        string     `json:"details"`
+	Status         string     `json:"status"`
+	ResolvedBy     *int64     `json:"resolved_by"`
+	ResolutionNote *string    `json:"resolution_note"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+} // @name Report
+
+// TargetType is comment for reports on comments, and post otherwise.
+func (r *Report) TargetType() string {
+	if r.CommentID != nil {
+		return "comment"
+	}
+	return "post"
+}
+
+type ReportStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+const reportColumns = `
+	id, reporter_id, post_id, comment_id, reason, details, status, resolved_by, resolution_note, resolved_at, created_at`
+
+func scanReport(row pgx.Row, report *Report) error {
+	return row.Scan(
+		&report.ID,
+		&report.ReporterID,
+		&report.PostID,
+		&report.CommentID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.ResolutionNote,
+		&report.ResolvedAt,
+		&report.CreatedAt,
+	)
+}
+
+// Create files a report, and hides the reported content once it has at least
+// hideThreshold open reports. A hideThreshold of 0 never hides content. It
+// returns whether the content was hidden by this report.
+func (s *ReportStore) Create(ctx context.Context, report *Report, hideThreshold int) (bool, error) {
+	var hidden bool
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO reports (reporter_id, post_id, comment_id, reason, details)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, status, created_at
+		`
+
+		if err := tx.QueryRow(ctx, query,
+			report.ReporterID,
+			report.PostID,
+			report.CommentID,
+			report.Reason,
+			report.Details,
+		).Scan(
+			&report.ID,
+			&report.Status,
+			&report.CreatedAt,
+		); err != nil {
+			if pgErr, ok := err.(*pgconn.PgError); ok {
+				switch pgErr.Code {
+				case "23505":
+					return ErrAlreadyExists
+				case "23503":
+					return ErrNotFound
+				}
+			}
+			return err
+		}
+
+		if hideThreshold <= 0 {
+			return nil
+		}
+
+		var err error
+		hidden, err = hideReported(ctx, tx, report, hideThreshold)
+		return err
+	})
+	return hidden, err
+}
+
+// hideReported hides the reported content when it has at least threshold
+// open reports, and isn't hidden already.
+func hideReported(ctx context.Context, tx pgx.Tx, report *Report, threshold int) (bool, error) {
+	query := `
+		UPDATE posts SET hidden_at = NOW()
+		WHERE id = $1 AND hidden_at IS NULL
+			AND (SELECT COUNT(*) FROM reports WHERE post_id = $1 AND comment_id IS NULL AND status = 'open') >= $2
+	`
+	id := report.PostID
+	if report.CommentID != nil {
+		query = `
+			UPDATE comments SET hidden_at = NOW()
+			WHERE id = $1 AND hidden_at IS NULL
+				AND (SELECT COUNT(*) FROM reports WHERE comment_id = $1 AND status = 'open') >= $2
+		`
+		id = *report.CommentID
+	}
+
+	res, err := tx.Exec(ctx, query, id, threshold)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *ReportStore) GetByID(ctx context.Context, id int64) (*Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT ` + reportColumns + ` FROM reports WHERE id = $1`
+
+	var report Report
+	if err := scanReport(s.db.QueryRow(ctx, query, id), &report); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &report, nil
+}
+
+func (s *ReportStore) Search(ctx context.Context, filter *ReportFilter, pageable *Pageable) (*Page[Report], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var q Query
+	q.Query(`SELECT ` + reportColumns + ` FROM reports WHERE 1 = 1`)
+
+	if filter.Status != "" {
+		q.Query(` AND status = `)
+		q.Param(filter.Status)
+	}
+
+	switch filter.TargetType {
+	case "post":
+		q.Query(` AND comment_id IS NULL`)
+	case "comment":
+		q.Query(` AND comment_id IS NOT NULL`)
+	}
+
+	if filter.Reason != "" {
+		q.Query(` AND reason = `)
+		q.Param(filter.Reason)
+	}
+
+	reversed, err := keysetQuery(&q, "created_at", "id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]Report, 0)
+	for rows.Next() {
+		var report Report
+		if err := scanReport(rows, &report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(reports, pageable, reversed, func(r Report) *Cursor {
+		return NewCursor(r.CreatedAt, r.ID)
+	}), nil
+}
+
+// Resolve sets the status of an open report to dismissed or actioned.
+// Actioning a report hides the content. Dismissing it shows content that was
+// hidden automatically again, once it has less than hideThreshold open reports
+// and no actioned ones. Reports that are not open return ErrConflict.
+func (s *ReportStore) Resolve(ctx context.Context, report *Report, hideThreshold int) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE reports SET status = $1, resolved_by = $2, resolution_note = $3, resolved_at = NOW()
+			WHERE id = $4 AND status = 'open'
+			RETURNING resolved_at
+		`
+
+		if err := tx.QueryRow(ctx, query,
+			report.Status,
+			report.ResolvedBy,
+			report.ResolutionNote,
+			report.ID,
+		).Scan(&report.ResolvedAt); err != nil {
+			switch err {
+			case pgx.ErrNoRows:
+				return ErrConflict
+			default:
+				return err
+			}
+		}
+
+		table, reportColumn, id := "posts", "post_id", report.PostID
+		reportScope := ` AND comment_id IS NULL`
+		if report.CommentID != nil {
+			table, reportColumn, id = "comments", "comment_id", *report.CommentID
+			reportScope = ``
+		}
+
+		if report.Status == ReportStatusActioned {
+			_, err := tx.Exec(ctx, `UPDATE `+table+` SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1`, id)
+			return err
+		}
+
+		query = `
+			UPDATE ` + table + ` SET hidden_at = NULL
+			WHERE id = $1 AND hidden_at IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM reports WHERE ` + reportColumn + ` = $1` + reportScope + ` AND status = 'actioned')
+				AND (SELECT COUNT(*) FROM reports WHERE ` + reportColumn + ` = $1` + reportScope + ` AND status = 'open') < $2
+		`
+		if hideThreshold <= 0 {
+			// Without automatic hiding, only actioned reports hide content
+			hideThreshold = 1
+		}
+
+		_, err := tx.Exec(ctx, query, id, hideThreshold)
+		return err
+	})
+}
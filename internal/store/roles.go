@@ -2,10 +2,12 @@ package store
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
@@ -17,8 +19,19 @@ type Role struct {
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"-"`
 	UpdatedAt   time.Time `json:"-"`
+
+	// Permissions are loaded by GetByName and GetAll, but not with the role of
+	// a user.
+	Permissions []string `json:"permissions,omitempty"`
 } // @name Role
 
+// Permission is a named action, like posts:delete:any, that roles can be
+// granted.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+} // @name Permission
+
 type RoleStore struct {
 	db     *pgxpool.Pool
 	logger *zap.SugaredLogger
@@ -29,7 +42,8 @@ func (s *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 	defer cancel()
 
 	query := `
-		SELECT id, name, level, description, created_at, updated_at 
+		SELECT id, name, level, description, created_at, updated_at,
+			ARRAY(SELECT permission FROM role_permissions WHERE role_id = roles.id ORDER BY permission)
 		FROM roles 
 		WHERE name = $1
 	`
@@ -42,6 +56,7 @@ func (s *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 		&role.Description,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Permissions,
 	)
 	if err != nil {
 		switch err {
@@ -53,3 +68,118 @@ func (s *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 	}
 	return &role, nil
 }
+
+// GetAll returns all roles with their permissions, lowest level first.
+func (s *RoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, name, level, description, created_at, updated_at,
+			ARRAY(SELECT permission FROM role_permissions WHERE role_id = roles.id ORDER BY permission)
+		FROM roles
+		ORDER BY level
+	`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]Role, 0)
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Level,
+			&role.Description,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+			&role.Permissions,
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *RoleStore) GetPermissions(ctx context.Context) ([]Permission, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make([]Permission, 0)
+	for rows.Next() {
+		var permission Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+// AddPermission grants the permission to the role. Granting a permission the
+// role already has is not an error, and unknown permissions are ErrNotFound.
+func (s *RoleStore) AddPermission(ctx context.Context, roleID int64, permission string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO role_permissions (role_id, permission)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := s.db.Exec(ctx, query, roleID, permission); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetUserIDs returns the IDs of the users with the role.
+func (s *RoleStore) GetUserIDs(ctx context.Context, roleID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT id FROM users WHERE role_id = $1`, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *RoleStore) RemovePermission(ctx context.Context, roleID int64, permission string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM role_permissions WHERE role_id = $1 AND permission = $2`, roleID, permission)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var ErrTokenReused = errors.New("refresh token has already been used")
+
+// Session is a login of a user, identified by its current refresh token. The
+// refresh token is rotated on every use, and only its hash is stored. The
+// hashes of the tokens rotated away are kept with the session, so a leaked
+// token is detected however many rotations ago it was used.
+type Session struct {
+	BaseEntity
+	UserID    int64      `json:"user_id"`
+	AccessJTI string     `json:"-"`
+	ExpireAt  time.Time  `json:"expire_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+} // @name Session
+
+type SessionStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_sessions (user_id, token, access_jti, expire_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.db.QueryRow(ctx, query, session.UserID, tokenHash, session.AccessJTI, session.ExpireAt).Scan(
+		&session.ID,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rotate replaces the refresh token of the session owning the given plain
+// token. If the token was rotated away by any earlier rotation, the session is
+// revoked and returned together with ErrTokenReused.
+func (s *SessionStore) Rotate(ctx context.Context, token string, newTokenHash string, accessJTI string, expireAt time.Time) (*Session, error) {
+	tokenHash := hashToken(token)
+
+	var session *Session
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE user_sessions
+			SET token = $1, access_jti = $2, expire_at = $3, updated_at = NOW()
+			WHERE token = $4 AND revoked_at IS NULL AND expire_at > NOW()
+			RETURNING id, user_id, access_jti, expire_at, revoked_at, created_at, updated_at
+		`
+
+		var err error
+		session, err = scanSession(tx.QueryRow(ctx, query, newTokenHash, accessJTI, expireAt, tokenHash))
+		if err == nil {
+			_, err = tx.Exec(ctx, `INSERT INTO user_session_tokens (token, session_id) VALUES ($1, $2)`, tokenHash, session.ID)
+			return err
+		} else if err != ErrNotFound {
+			return err
+		}
+
+		// A rotated token being presented again means it has leaked, so the
+		// whole session is revoked.
+		reuseQuery := `
+			UPDATE user_sessions
+			SET revoked_at = NOW(), updated_at = NOW()
+			WHERE id = (SELECT session_id FROM user_session_tokens WHERE token = $1) AND revoked_at IS NULL
+			RETURNING id, user_id, access_jti, expire_at, revoked_at, created_at, updated_at
+		`
+
+		session, err = scanSession(tx.QueryRow(ctx, reuseQuery, tokenHash))
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if session.RevokedAt != nil {
+		return session, ErrTokenReused
+	}
+	return session, nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, id int64, userID int64) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE user_sessions
+		SET revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		RETURNING id, user_id, access_jti, expire_at, revoked_at, created_at, updated_at
+	`
+
+	return scanSession(s.db.QueryRow(ctx, query, id, userID))
+}
+
+// RevokeAllByUserID revokes every active session of a user, and returns the
+// revoked sessions so their access tokens can be revoked as well.
+func (s *SessionStore) RevokeAllByUserID(ctx context.Context, userID int64) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE user_sessions
+		SET revoked_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expire_at > NOW()
+		RETURNING id, user_id, access_jti, expire_at, revoked_at, created_at, updated_at
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SessionStore) RevokeToken(ctx context.Context, jti string, expireAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO revoked_tokens (jti, expire_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	if _, err := s.db.Exec(ctx, query, jti, expireAt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SessionStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var revoked bool
+	if err := s.db.QueryRow(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// PurgeExpired deletes expired and revoked sessions, and revoked tokens that
+// have expired anyway.
+func (s *SessionStore) PurgeExpired(ctx context.Context) (int64, error) {
+	var purged int64
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		now := time.Now()
+
+		res, err := tx.Exec(ctx, `DELETE FROM user_sessions WHERE expire_at < $1 OR revoked_at IS NOT NULL`, now)
+		if err != nil {
+			return err
+		}
+		purged += res.RowsAffected()
+
+		res, err = tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expire_at < $1`, now)
+		if err != nil {
+			return err
+		}
+		purged += res.RowsAffected()
+		return nil
+	})
+	return purged, err
+}
+
+func scanSession(row pgx.Row) (*Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.AccessJTI,
+		&session.ExpireAt,
+		&session.RevokedAt,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
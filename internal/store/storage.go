@@ -25,7 +25,7 @@ type Storage struct {
 	Logger *zap.SugaredLogger
 	Posts  interface {
 		GetByID(context.Context, int64) (*Post, error)
-		GetUserFeed(context.Context, int64, *Pageable, *FeedFilter) ([]PostWithMetadata, error)
+		GetUserFeed(context.Context, int64, *Pageable, *FeedFilter) (*Page[PostWithMetadata], error)
 
 		Create(context.Context, *Post) error
 		Update(context.Context, *Post) error
@@ -41,39 +41,171 @@ type Storage struct {
 		CreateAndInvite(ctx context.Context, user *User, token string, inviteExpire time.Duration) error
 
 		Update(context.Context, pgx.Tx, *User) error
+		UpdateProfile(context.Context, *User) error
 		Delete(context.Context, int64) error
 
-		Activate(context.Context, string) error
+		Activate(context.Context, string) (*User, error)
+		Reinvite(ctx context.Context, email string, token string, exp time.Duration) (*User, error)
+
+		GetStats(ctx context.Context, userID int64, viewerID int64) (*UserStats, error)
+
+		Lock(ctx context.Context, userID int64, until time.Time) error
+		Unlock(ctx context.Context, userID int64) error
+
+		Search(context.Context, *UserFilter, *Pageable) (*Page[User], error)
+		GetForAdmin(context.Context, int64) (*User, error)
+		SetRole(ctx context.Context, userID int64, roleID int64) error
+		Ban(ctx context.Context, userID int64, reason string, until *time.Time) error
+		Unban(ctx context.Context, userID int64) error
+		ForceActivate(context.Context, int64) error
+
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, newPassword string) (*User, error)
+		ChangePassword(context.Context, *User) error
+		CreateEmailChange(ctx context.Context, userID int64, email string, token string, exp time.Duration) error
+
+		PurgeExpiredInvitations(context.Context) (int64, error)
+		PurgeExpiredPasswordResets(context.Context) (int64, error)
+		PurgeUnactivated(ctx context.Context, gracePeriod time.Duration) (int64, error)
 
 		CreateBatch(context.Context, []*User) error // For DB seeding
 	}
+	Audit interface {
+		Record(context.Context, *AuditEvent) error
+		Search(context.Context, *AuditFilter, *Pageable) (*Page[AuditEvent], error)
+		PurgeBefore(ctx context.Context, before time.Time) (int64, error)
+	}
+	APIKeys interface {
+		Create(ctx context.Context, key *APIKey, keyHash string) error
+		GetByUserID(context.Context, int64) ([]APIKey, error)
+		GetByKey(context.Context, string) (*APIKey, error)
+		CountByUserID(context.Context, int64) (int, error)
+		Touch(ctx context.Context, id int64, interval time.Duration) error
+		Delete(ctx context.Context, id int64, userID int64) error
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID int64, userID int64) error
+		Unblock(ctx context.Context, blockerID int64, userID int64) error
+		Mute(ctx context.Context, muterID int64, userID int64) error
+		Unmute(ctx context.Context, muterID int64, userID int64) error
+
+		IsBlocked(ctx context.Context, userID int64, otherID int64) (bool, error)
+		GetBlockedIDs(context.Context, int64) ([]int64, error)
+	}
 	Comments interface {
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostID(context.Context, int64, *Pageable) (*Page[Comment], error)
+		GetReplies(context.Context, int64, *Pageable) (*Page[Comment], error)
+		CountByPostID(context.Context, int64) (int, error)
 
 		Create(context.Context, *Comment) error
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
 
 		CreateBatch(context.Context, []*Comment) error // For DB seeding
 	}
 	Follow interface {
-		Follow(ctx context.Context, followerID int64, userID int64) error
+		Follow(ctx context.Context, followerID int64, userID int64) (requested bool, err error)
 		Unfollow(ctx context.Context, followerID int64, userID int64) error
+		IsFollowing(ctx context.Context, followerID int64, userID int64) (bool, error)
+
+		GetRequests(ctx context.Context, userID int64, pageable *Pageable) (*Page[FollowRequest], error)
+		ApproveRequest(ctx context.Context, userID int64, requesterID int64) error
+		ApproveAllRequests(ctx context.Context, userID int64) (int64, error)
+		RejectRequest(ctx context.Context, userID int64, requesterID int64) error
+
+		GetFollowers(ctx context.Context, userID int64, viewerID int64, pageable *Pageable) (*Page[FollowUser], error)
+		GetFollowing(ctx context.Context, userID int64, viewerID int64, pageable *Pageable) (*Page[FollowUser], error)
 
 		CreateBatch(context.Context, []*Follower) error // For DB seeding
 	}
+	Identities interface {
+		GetUserID(ctx context.Context, provider string, subject string) (int64, error)
+		GetByUserID(context.Context, int64) ([]Identity, error)
+
+		LinkByEmail(ctx context.Context, identity *Identity, linkActive bool) (claimed bool, err error)
+		CreateUser(context.Context, *User, *Identity) error
+		Delete(ctx context.Context, userID int64, provider string) error
+
+		CreateAuthRequest(ctx context.Context, stateHash string, req *AuthRequest) error
+		ConsumeAuthRequest(ctx context.Context, state string) (*AuthRequest, error)
+		PurgeExpiredAuthRequests(context.Context) (int64, error)
+	}
+	TwoFactor interface {
+		SetSecret(ctx context.Context, userID int64, secret string) error
+		Get(ctx context.Context, userID int64) (*TOTP, error)
+		Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error
+		Disable(ctx context.Context, userID int64) error
+		UseStep(ctx context.Context, userID int64, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+		ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodes []string) error
+
+		CreateChallenge(ctx context.Context, userID int64, tokenHash string, expireAt time.Time) error
+		GetChallenge(ctx context.Context, token string) (*LoginChallenge, error)
+		FailChallenge(ctx context.Context, token string, maxAttempts int) error
+		DeleteChallenge(ctx context.Context, token string) error
+		PurgeExpiredChallenges(ctx context.Context) (int64, error)
+	}
+	LoginAttempts interface {
+		RecordFailure(ctx context.Context, email string, ip string) error
+		CountFailures(ctx context.Context, email string, ip string, since time.Time) (*LoginFailures, error)
+		ClearFailures(ctx context.Context, email string) error
+		PurgeBefore(ctx context.Context, before time.Time) (int64, error)
+	}
+	Reactions interface {
+		Set(ctx context.Context, postID int64, userID int64, reactionType string) (previous *string, err error)
+		Delete(ctx context.Context, postID int64, userID int64, reactionType string) error
+
+		GetCounts(ctx context.Context, postIDs []int64) (map[int64]ReactionCounts, error)
+		GetUserReaction(ctx context.Context, postID int64, userID int64) (*string, error)
+	}
+	Reports interface {
+		Create(ctx context.Context, report *Report, hideThreshold int) (bool, error)
+		GetByID(context.Context, int64) (*Report, error)
+		Search(context.Context, *ReportFilter, *Pageable) (*Page[Report], error)
+		Resolve(ctx context.Context, report *Report, hideThreshold int) error
+	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		GetAll(context.Context) ([]Role, error)
+		GetPermissions(context.Context) ([]Permission, error)
+		GetUserIDs(ctx context.Context, roleID int64) ([]int64, error)
+
+		AddPermission(ctx context.Context, roleID int64, permission string) error
+		RemovePermission(ctx context.Context, roleID int64, permission string) error
+	}
+	Sessions interface {
+		Create(ctx context.Context, session *Session, tokenHash string) error
+		Rotate(ctx context.Context, token string, newTokenHash string, accessJTI string, expireAt time.Time) (*Session, error)
+
+		Revoke(ctx context.Context, id int64, userID int64) (*Session, error)
+		RevokeAllByUserID(context.Context, int64) ([]Session, error)
+
+		RevokeToken(ctx context.Context, jti string, expireAt time.Time) error
+		IsTokenRevoked(context.Context, string) (bool, error)
+
+		PurgeExpired(context.Context) (int64, error)
 	}
 }
 
 func NewStorage(db *pgxpool.Pool, logger *zap.SugaredLogger) Storage {
 	storeLogger := logger.Named("store")
 	return Storage{
-		Logger:   storeLogger,
-		Posts:    &PostStore{db, storeLogger.Named("posts")},
-		Users:    &UserStore{db, storeLogger.Named("users")},
-		Comments: &CommentStore{db, storeLogger.Named("comments")},
-		Follow:   &FollowerStore{db, storeLogger.Named("followers")},
-		Roles:    &RoleStore{db, storeLogger.Named("roles")},
+		Logger:        storeLogger,
+		Posts:         &PostStore{db, storeLogger.Named("posts")},
+		Users:         &UserStore{db, storeLogger.Named("users")},
+		APIKeys:       &APIKeyStore{db, storeLogger.Named("api_keys")},
+		Audit:         &AuditStore{db, storeLogger.Named("audit")},
+		Blocks:        &BlockStore{db, storeLogger.Named("blocks")},
+		Comments:      &CommentStore{db, storeLogger.Named("comments")},
+		Follow:        &FollowerStore{db, storeLogger.Named("followers")},
+		Identities:    &IdentityStore{db, storeLogger.Named("identities")},
+		LoginAttempts: &LoginAttemptStore{db, storeLogger.Named("login_attempts")},
+		Reactions:     &ReactionStore{db, storeLogger.Named("reactions")},
+		Reports:       &ReportStore{db, storeLogger.Named("reports")},
+		Roles:         &RoleStore{db, storeLogger.Named("roles")},
+		Sessions:      &SessionStore{db, storeLogger.Named("sessions")},
+		TwoFactor:     &TwoFactorStore{db, storeLogger.Named("two_factor")},
 	}
 }
 
@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var ErrCodeReused = errors.New("code has already been used")
+
+// TOTP is the TOTP secret of a user. Two-factor authentication is only
+// required once the user has verified a code, which sets EnabledAt.
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	LastUsedStep int64
+	EnabledAt    *time.Time
+	CreatedAt    time.Time
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// LoginChallenge is the first, password verified, step of a two-factor login.
+type LoginChallenge struct {
+	UserID   int64
+	Attempts int
+	ExpireAt time.Time
+}
+
+type TwoFactorStore struct {
+	db     *pgxpool.Pool
+	logger *zap.SugaredLogger
+}
+
+// SetSecret starts the enrollment of a user, replacing any secret that has not
+// been enabled yet.
+func (s *TwoFactorStore) SetSecret(ctx context.Context, userID int64, secret string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`
+
+	res, err := s.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) Get(ctx context.Context, userID int64) (*TOTP, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT user_id, secret, last_used_step, enabled_at, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`
+
+	var totp TOTP
+	err := s.db.QueryRow(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastUsedStep,
+		&totp.EnabledAt,
+		&totp.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// Enable turns on two-factor authentication for a user, and replaces the
+// recovery codes of the user with the given plain codes.
+func (s *TwoFactorStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE user_totp
+			SET enabled_at = NOW(), last_used_step = $1
+			WHERE user_id = $2 AND enabled_at IS NULL
+		`
+
+		res, err := tx.Exec(ctx, query, step, userID)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return s.replaceRecoveryCodes(ctx, tx, userID, recoveryCodes)
+	})
+}
+
+// Disable turns off two-factor authentication for a user, and deletes the
+// secret and recovery codes.
+func (s *TwoFactorStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// UseStep marks the time step of a valid code as used. Codes of the same or
+// an earlier step are rejected with ErrCodeReused, so a code can't be replayed.
+func (s *TwoFactorStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+
+	res, err := s.db.Exec(ctx, query, step, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrCodeReused
+	}
+	return nil
+}
+
+// UseRecoveryCode uses up a plain recovery code of a user. It returns
+// ErrNotFound if the code does not exist or has been used.
+func (s *TwoFactorStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code = $2 AND used_at IS NULL`
+
+	res, err := s.db.Exec(ctx, query, userID, hashToken(code))
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		return s.replaceRecoveryCodes(ctx, tx, userID, recoveryCodes)
+	})
+}
+
+func (s *TwoFactorStore) replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, recoveryCodes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		if _, err := tx.Exec(ctx, `INSERT INTO recovery_codes (code, user_id) VALUES ($1, $2)`, hashToken(code), userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) CreateChallenge(ctx context.Context, userID int64, tokenHash string, expireAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `INSERT INTO login_challenges (token, user_id, expire_at) VALUES ($1, $2, $3)`
+
+	if _, err := s.db.Exec(ctx, query, tokenHash, userID, expireAt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetChallenge returns the unexpired challenge of a plain challenge token.
+func (s *TwoFactorStore) GetChallenge(ctx context.Context, token string) (*LoginChallenge, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT user_id, attempts, expire_at
+		FROM login_challenges
+		WHERE token = $1 AND expire_at > NOW()
+	`
+
+	var challenge LoginChallenge
+	err := s.db.QueryRow(ctx, query, hashToken(token)).Scan(
+		&challenge.UserID,
+		&challenge.Attempts,
+		&challenge.ExpireAt,
+	)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &challenge, nil
+}
+
+// FailChallenge counts a wrong code against a challenge. The challenge is
+// deleted once it has failed maxAttempts times.
+func (s *TwoFactorStore) FailChallenge(ctx context.Context, token string, maxAttempts int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tokenHash := hashToken(token)
+
+	var attempts int
+	err := s.db.QueryRow(ctx, `UPDATE login_challenges SET attempts = attempts + 1 WHERE token = $1 RETURNING attempts`, tokenHash).Scan(&attempts)
+	if err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	if attempts >= maxAttempts {
+		return s.DeleteChallenge(ctx, token)
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) DeleteChallenge(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM login_challenges WHERE token = $1`, hashToken(token)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) PurgeExpiredChallenges(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.Exec(ctx, `DELETE FROM login_challenges WHERE expire_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
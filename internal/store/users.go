@@ -3,11 +3,13 @@ package store
 import (
 	"cmp"
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -25,15 +27,70 @@ var (
 
 type User struct {
 	BaseEntity
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Profile
 	Password  password  `json:"-"`
 	IsActive  bool      `json:"is_active"`
+	IsPrivate bool      `json:"is_private"`
 	RoleID    int64     `json:"-"`
 	Role      Role      `json:"role"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// LockedUntil is set while the account is locked after too many failed
+	// login attempts.
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+
+	// BannedAt is set while the user is banned. Bans without BannedUntil
+	// don't expire.
+	BannedAt    *time.Time `json:"banned_at,omitempty"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+	BanReason   *string    `json:"ban_reason,omitempty"`
+
+	// Permissions are the permissions granted to the role of the user.
+	Permissions []string `json:"permissions"`
 } // @name User
 
+// Profile is the part of a user that the user presents to others.
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	Location    string `json:"location"`
+	Website     string `json:"website"`
+}
+
+// PublicUser is the projection of a user that is safe to show to other users.
+// The posts of private users are only shown to their approved followers.
+type PublicUser struct {
+	BaseEntity
+	Username  string `json:"username"`
+	IsPrivate bool   `json:"is_private"`
+	Profile
+} // @name PublicUser
+
+// UserStats are the counters shown on the profile of a user. IsFollowedByMe is
+// only set when the profile is viewed by another user.
+type UserStats struct {
+	FollowersCount int   `json:"followers_count"`
+	FollowingCount int   `json:"following_count"`
+	PostsCount     int   `json:"posts_count"`
+	IsFollowedByMe *bool `json:"is_followed_by_me,omitempty"`
+} // @name UserStats
+
+func (u *User) HasPermission(permission string) bool {
+	return slices.Contains(u.Permissions, permission)
+}
+
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		BaseEntity: u.BaseEntity,
+		Username:   u.Username,
+		IsPrivate:  u.IsPrivate,
+		Profile:    u.Profile,
+	}
+}
+
 type password struct {
 	text *string
 	hash []byte
@@ -49,6 +106,16 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+// SetRandom sets a random password that nobody knows, so the password can't
+// be used to log in.
+func (p *password) SetRandom() error {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	return p.Set(hex.EncodeToString(random))
+}
+
 func (p *password) Compare(password string) error {
 	if password == "" {
 		return errors.New("no password provided")
@@ -105,7 +172,11 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	var user User
 
 	query := `
-		SELECT u.id, u.email, u.username, u.password, u.created_at, u.updated_at, u.is_active, u.role_id, r.*
+		SELECT 
+			u.id, u.email, u.username, u.password, u.created_at, u.updated_at, u.is_active, u.role_id, r.*,
+			u.display_name, u.bio, u.avatar_url, u.location, u.website, u.locked_until,
+			u.banned_at, u.banned_until, u.ban_reason, u.is_private,
+			ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role_id = u.role_id ORDER BY rp.permission)
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
 		WHERE u.id = $1 AND u.is_active = true
@@ -126,6 +197,17 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 		&user.Role.Description,
 		&user.Role.CreatedAt,
 		&user.Role.UpdatedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.LockedUntil,
+		&user.BannedAt,
+		&user.BannedUntil,
+		&user.BanReason,
+		&user.IsPrivate,
+		&user.Permissions,
 	)
 	if err != nil {
 		switch err {
@@ -145,7 +227,11 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	var user User
 
 	query := `
-		SELECT u.id, u.email, u.username, u.password, u.created_at, u.updated_at, u.is_active, u.role_id, r.*
+		SELECT 
+			u.id, u.email, u.username, u.password, u.created_at, u.updated_at, u.is_active, u.role_id, r.*,
+			u.display_name, u.bio, u.avatar_url, u.location, u.website, u.locked_until,
+			u.banned_at, u.banned_until, u.ban_reason, u.is_private,
+			ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role_id = u.role_id ORDER BY rp.permission)
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
 		WHERE u.email = $1 AND u.is_active = true
@@ -166,6 +252,17 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Role.Description,
 		&user.Role.CreatedAt,
 		&user.Role.UpdatedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.LockedUntil,
+		&user.BannedAt,
+		&user.BannedUntil,
+		&user.BanReason,
+		&user.IsPrivate,
+		&user.Permissions,
 	)
 	if err != nil {
 		switch err {
@@ -242,24 +339,93 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx pgx.Tx, token s
 	return nil
 }
 
+// Update saves the user. The update is done within tx, or directly on the pool
+// when tx is nil.
 func (s *UserStore) Update(ctx context.Context, tx pgx.Tx, user *User) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	query := `
 		UPDATE users 
-		SET email = $1, username = $2, is_active = $3, role_id = (SELECT id FROM roles WHERE name = $4), updated_at = $5
-		WHERE id = $6
+		SET email = $1, username = $2, is_active = $3, role_id = (SELECT id FROM roles WHERE name = $4), updated_at = $5,
+			display_name = $6, bio = $7, avatar_url = $8, location = $9, website = $10, is_private = $11
+		WHERE id = $12
 	`
 
-	if _, err := s.db.Exec(ctx, query, strings.TrimSpace(strings.ToLower(user.Email)), user.Username, user.IsActive, cmp.Or(strings.ToLower(strings.TrimSpace(user.Role.Name)), "user"), time.Now(), user.ID); err != nil {
-		switch err {
-		case pgx.ErrNoRows:
-			return ErrDirtyRecord
-		default:
-			return err
+	exec := s.db.Exec
+	if tx != nil {
+		exec = tx.Exec
+	}
+
+	updatedAt := time.Now()
+	res, err := exec(ctx, query,
+		strings.TrimSpace(strings.ToLower(user.Email)),
+		user.Username,
+		user.IsActive,
+		cmp.Or(strings.ToLower(strings.TrimSpace(user.Role.Name)), "user"),
+		updatedAt,
+		user.DisplayName,
+		user.Bio,
+		user.AvatarURL,
+		user.Location,
+		user.Website,
+		user.IsPrivate,
+		user.ID,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+			switch pgErr.ConstraintName {
+			case "users_email_key":
+				return ErrDuplicateEmail
+			case "users_username_key":
+				return ErrDuplicateUsername
+			}
 		}
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
 	}
+
+	user.UpdatedAt = updatedAt
+	return nil
+}
+
+// UpdateProfile saves only the username, profile and privacy of the user, so
+// a stale copy of the user can't undo changes to its email, activation or
+// role.
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE users 
+		SET username = $1, display_name = $2, bio = $3, avatar_url = $4, location = $5, website = $6,
+			is_private = $7, updated_at = $8
+		WHERE id = $9
+	`
+
+	updatedAt := time.Now()
+	res, err := s.db.Exec(ctx, query,
+		user.Username,
+		user.DisplayName,
+		user.Bio,
+		user.AvatarURL,
+		user.Location,
+		user.Website,
+		user.IsPrivate,
+		updatedAt,
+		user.ID,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" && pgErr.ConstraintName == "users_username_key" {
+			return ErrDuplicateUsername
+		}
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	user.UpdatedAt = updatedAt
 	return nil
 }
 
@@ -285,51 +451,85 @@ func (s *UserStore) Delete(ctx context.Context, id int64) error {
 	})
 }
 
-func (s *UserStore) Activate(ctx context.Context, token string) error {
-	return withTx(s.db, ctx, func(tx pgx.Tx) error {
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+// Activate activates the user of the plain invitation token. Invitations for
+// an email change also move the user to the new, now verified, email. Nothing
+// else of the user is written.
+func (s *UserStore) Activate(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		u, email, err := s.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
 
-		user.IsActive = true
-		if err := s.Update(ctx, tx, user); err != nil {
+		if email != nil {
+			u.Email = *email
+		}
+
+		if err := s.activate(ctx, tx, u); err != nil {
 			return err
 		}
 
-		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+		if err := s.deleteUserInvitations(ctx, tx, u.ID); err != nil {
 			return err
 		}
 
+		user = u
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func (s *UserStore) getUserFromInvitation(ctx context.Context, tx pgx.Tx, token string) (*User, error) {
+// activate saves the email of the user, and marks them active.
+func (s *UserStore) activate(ctx context.Context, tx pgx.Tx, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET email = $1, is_active = true, updated_at = $2 WHERE id = $3`
+
+	updatedAt := time.Now()
+	if _, err := tx.Exec(ctx, query, strings.TrimSpace(strings.ToLower(user.Email)), updatedAt, user.ID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "users_email_key" {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	user.IsActive = true
+	user.UpdatedAt = updatedAt
+	return nil
+}
+
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx pgx.Tx, token string) (*User, *string, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	query := `
 		SELECT 
-			u.id, u.username, u.email, u.created_at, u.updated_at, u.is_active, u.role_id, r.*
+			u.id, u.email, u.username, u.created_at, u.updated_at, u.is_active, u.role_id, 
+			r.id, r.name, r.level, r.description, r.created_at, r.updated_at,
+			u.display_name, u.bio, u.avatar_url, u.location, u.website, u.is_private,
+			i.email
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
-		LEFT JOIN user_invitations i ON u.id = i.user_id
+		JOIN user_invitations i ON u.id = i.user_id
 		WHERE i.token = $1 AND i.expire_at > $2
 	`
 
-	hash := sha256.Sum256([]byte(token))
-	hashToken := hex.EncodeToString(hash[:])
 	var user User
+	var email *string
 	if err := tx.QueryRow(ctx,
 		query,
-		hashToken,
+		hashToken(token),
 		time.Now(),
 	).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Username,
-		&user.Password.hash,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.IsActive,
@@ -340,6 +540,164 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx pgx.Tx, token
 		&user.Role.Description,
 		&user.Role.CreatedAt,
 		&user.Role.UpdatedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.IsPrivate,
+		&email,
+	); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, nil, ErrNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &user, email, nil
+}
+
+// CreateEmailChange invites the user to verify a new email. The email is only
+// changed once the invitation is accepted through Activate.
+func (s *UserStore) CreateEmailChange(ctx context.Context, userID int64, email string, token string, exp time.Duration) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var taken bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&taken); err != nil {
+			return err
+		} else if taken {
+			return ErrDuplicateEmail
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO 
+				user_invitations (token, user_id, expire_at, email)
+			VALUES ($1, $2, $3, $4)
+		`
+
+		if _, err := tx.Exec(ctx, query, token, userID, time.Now().Add(exp), email); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ChangePassword saves the password that has been set on the user.
+func (s *UserStore) ChangePassword(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		return s.updatePassword(ctx, tx, user)
+	})
+}
+
+func (s *UserStore) deleteUserInvitations(ctx context.Context, tx pgx.Tx, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM user_invitations WHERE user_id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		// Only the latest requested reset token is valid
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO 
+				password_resets (token, user_id, expire_at)
+			VALUES ($1, $2, $3)
+		`
+
+		if _, err := tx.Exec(ctx, query, token, userID, time.Now().Add(exp)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ResetPassword sets a new password for the user of the plain reset token. The
+// token is consumed atomically, so it can only be used once even by concurrent
+// requests.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, newPassword string) (*User, error) {
+	var pw password
+	if err := pw.Set(newPassword); err != nil {
+		return nil, err
+	}
+
+	var user *User
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		u, err := s.consumePasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		u.Password = pw
+
+		if err := s.updatePassword(ctx, tx, u); err != nil {
+			return err
+		}
+
+		if err := s.deletePasswordResets(ctx, tx, u.ID); err != nil {
+			return err
+		}
+
+		user = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// consumePasswordReset deletes the reset token and returns its user. A
+// concurrent request with the same token waits on the deleted row, and then
+// finds nothing to delete.
+func (s *UserStore) consumePasswordReset(ctx context.Context, tx pgx.Tx, token string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		WITH pr AS (
+			DELETE FROM password_resets WHERE token = $1 AND expire_at > $2 RETURNING user_id
+		)
+		SELECT 
+			u.id, u.username, u.email, u.created_at, u.updated_at, u.is_active, u.role_id
+		FROM users u
+		JOIN pr ON u.id = pr.user_id
+		WHERE u.is_active = true
+	`
+
+	var user User
+	if err := tx.QueryRow(ctx,
+		query,
+		hashToken(token),
+		time.Now(),
+	).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+		&user.RoleID,
 	); err != nil {
 		switch err {
 		case pgx.ErrNoRows:
@@ -352,13 +710,404 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx pgx.Tx, token
 	return &user, nil
 }
 
-func (s *UserStore) deleteUserInvitations(ctx context.Context, tx pgx.Tx, userID int64) error {
+func (s *UserStore) updatePassword(ctx context.Context, tx pgx.Tx, user *User) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	query := `DELETE FROM user_invitations WHERE user_id = $1`
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	res, err := tx.Exec(ctx, query, user.Password.hash, time.Now(), user.ID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx pgx.Tx, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM password_resets WHERE user_id = $1`
 	if _, err := tx.Exec(ctx, query, userID); err != nil {
 		return err
 	}
 	return nil
 }
+
+// Reinvite replaces the invitations of an inactive user with a new one, and
+// returns the user. Active and unknown users are reported as ErrNotFound.
+func (s *UserStore) Reinvite(ctx context.Context, email string, token string, exp time.Duration) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx pgx.Tx) error {
+		u, err := s.getInactiveByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, u.ID); err != nil {
+			return err
+		}
+
+		if err := s.createUserInvitation(ctx, tx, token, u.ID, exp); err != nil {
+			return err
+		}
+
+		user = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserStore) getInactiveByEmail(ctx context.Context, tx pgx.Tx, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, username, email, created_at, updated_at, is_active, role_id
+		FROM users
+		WHERE email = $1 AND is_active = false
+	`
+
+	var user User
+	if err := tx.QueryRow(ctx, query, strings.TrimSpace(strings.ToLower(email))).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+		&user.RoleID,
+	); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (s *UserStore) PurgeExpiredInvitations(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM user_invitations WHERE expire_at < $1`
+
+	res, err := s.db.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (s *UserStore) PurgeExpiredPasswordResets(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `DELETE FROM password_resets WHERE expire_at < $1`
+
+	res, err := s.db.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// PurgeUnactivated deletes users that never activated their account within the
+// grace period, unless they still have a valid invitation.
+func (s *UserStore) PurgeUnactivated(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		DELETE FROM users u
+		WHERE u.is_active = false AND u.created_at < $1 AND NOT EXISTS (
+			SELECT 1 FROM user_invitations i WHERE i.user_id = u.id AND i.expire_at > $2
+		)
+	`
+
+	now := time.Now()
+	res, err := s.db.Exec(ctx, query, now.Add(-gracePeriod), now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// IsLocked reports whether the account is locked after too many failed login
+// attempts.
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
+// IsBanned reports whether the user is banned, and the ban has not expired.
+func (u *User) IsBanned() bool {
+	return u.BannedAt != nil && (u.BannedUntil == nil || u.BannedUntil.After(time.Now()))
+}
+
+// dummyPassword is compared against when logging in as an unknown user, so it
+// takes as long as a wrong password for a known user.
+var dummyPassword = sync.OnceValue(func() *password {
+	random := make([]byte, 32)
+	_, _ = rand.Read(random)
+
+	var p password
+	_ = p.Set(hex.EncodeToString(random))
+	return &p
+})
+
+// CompareDummyPassword spends the time of a password comparison without a
+// user to compare against.
+func CompareDummyPassword(text string) {
+	_ = dummyPassword().Compare(text)
+}
+
+// Lock locks the account of a user until the given time.
+func (s *UserStore) Lock(ctx context.Context, userID int64, until time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET locked_until = $1 WHERE id = $2`
+
+	res, err := s.db.Exec(ctx, query, until, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) Unlock(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET locked_until = NULL WHERE id = $1`
+
+	res, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) GetStats(ctx context.Context, userID int64, viewerID int64) (*UserStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT 
+			(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.follower_id WHERE f.user_id = $1 AND u.is_active = true),
+			(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.user_id WHERE f.follower_id = $1 AND u.is_active = true),
+			(SELECT COUNT(*) FROM posts WHERE user_id = $1),
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+	`
+
+	var stats UserStats
+	var followedByMe bool
+	if err := s.db.QueryRow(ctx, query, userID, viewerID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.PostsCount,
+		&followedByMe,
+	); err != nil {
+		return nil, err
+	}
+
+	if userID != viewerID {
+		stats.IsFollowedByMe = &followedByMe
+	}
+	return &stats, nil
+}
+
+// adminUserColumns are the columns of a user shown to admins, read by
+// scanAdminUser.
+const adminUserColumns = `
+	u.id, u.email, u.username, u.created_at, u.updated_at, u.is_active, u.role_id,
+	r.id, r.name, r.level, r.description, r.created_at, r.updated_at,
+	u.display_name, u.bio, u.avatar_url, u.location, u.website, u.locked_until,
+	u.banned_at, u.banned_until, u.ban_reason, u.is_private
+`
+
+func scanAdminUser(row pgx.Row, user *User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+		&user.RoleID,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+		&user.Role.CreatedAt,
+		&user.Role.UpdatedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.LockedUntil,
+		&user.BannedAt,
+		&user.BannedUntil,
+		&user.BanReason,
+		&user.IsPrivate,
+	)
+}
+
+// Search lists users for admins, including inactive and banned users. Search
+// matches the username, email and display name.
+func (s *UserStore) Search(ctx context.Context, filter *UserFilter, pageable *Pageable) (*Page[User], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var q Query
+	q.Query(`SELECT ` + adminUserColumns + ` FROM users u JOIN roles r ON u.role_id = r.id WHERE 1 = 1`)
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		q.Query(` AND (u.username ILIKE '%' || `)
+		q.Param(search)
+		q.Query(` || '%' OR u.email ILIKE '%' || `)
+		q.Param(search)
+		q.Query(` || '%' OR u.display_name ILIKE '%' || `)
+		q.Param(search)
+		q.Query(` || '%')`)
+	}
+
+	if filter.Role != "" {
+		q.Query(` AND r.name = `)
+		q.Param(filter.Role)
+	}
+
+	switch filter.Status {
+	case "active":
+		q.Query(` AND u.is_active = true`)
+	case "inactive":
+		q.Query(` AND u.is_active = false`)
+	case "banned":
+		q.Query(` AND u.banned_at IS NOT NULL AND (u.banned_until IS NULL OR u.banned_until > NOW())`)
+	case "locked":
+		q.Query(` AND u.locked_until > NOW()`)
+	}
+
+	reversed, err := keysetQuery(&q, "u.created_at", "u.id", pageable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, q.GetQuery(), q.GetParams()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err := scanAdminUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(users, pageable, reversed, func(u User) *Cursor {
+		return NewCursor(u.CreatedAt, u.ID)
+	}), nil
+}
+
+// GetForAdmin returns the user with the ID, including inactive and banned
+// users.
+func (s *UserStore) GetForAdmin(ctx context.Context, id int64) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT ` + adminUserColumns + ` FROM users u JOIN roles r ON u.role_id = r.id WHERE u.id = $1`
+
+	var user User
+	if err := scanAdminUser(s.db.QueryRow(ctx, query, id), &user); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (s *UserStore) SetRole(ctx context.Context, userID int64, roleID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2`
+
+	res, err := s.db.Exec(ctx, query, roleID, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Ban bans the user until the given time, or for good when until is nil.
+func (s *UserStore) Ban(ctx context.Context, userID int64, reason string, until *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET banned_at = NOW(), banned_until = $1, ban_reason = $2 WHERE id = $3`
+
+	res, err := s.db.Exec(ctx, query, until, reason, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) Unban(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET banned_at = NULL, banned_until = NULL, ban_reason = NULL WHERE id = $1`
+
+	res, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ForceActivate activates the user without an invitation, and deletes any
+// pending invitations.
+func (s *UserStore) ForceActivate(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.Exec(ctx, `UPDATE users SET is_active = true, updated_at = NOW() WHERE id = $1`, userID)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return s.deleteUserInvitations(ctx, tx, userID)
+	})
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// newTestUserStore connects to the migrated database of TEST_DATABASE_URL.
+// Tests that need a database are skipped without one.
+func newTestUserStore(t *testing.T) *UserStore {
+	t.Helper()
+
+	connString := os.Getenv("TEST_DATABASE_URL")
+	if connString == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return &UserStore{pool, zap.NewNop().Sugar()}
+}
+
+func TestActivateEmailChangeKeepsPrivateAccount(t *testing.T) {
+	s := newTestUserStore(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	user := &User{
+		Username: fmt.Sprintf("private-%d", suffix),
+		Email:    fmt.Sprintf("private-%d@example.com", suffix),
+	}
+	if err := user.Password.Set("password123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateAndInvite(ctx, user, hashToken("invite"+user.Username), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Delete(context.Background(), user.ID) })
+
+	if _, err := s.Activate(ctx, "invite"+user.Username); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+
+	user.IsPrivate = true
+	if err := s.UpdateProfile(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	newEmail := fmt.Sprintf("changed-%d@example.com", suffix)
+	if err := s.CreateEmailChange(ctx, user.ID, newEmail, hashToken("change"+user.Username), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Activate(ctx, "change"+user.Username); err != nil {
+		t.Fatalf("Activate() email change error = %v", err)
+	}
+
+	got, err := s.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != newEmail {
+		t.Errorf("Email = %q, want %q", got.Email, newEmail)
+	}
+	if !got.IsPrivate {
+		t.Error("IsPrivate = false after the email change, want true")
+	}
+}